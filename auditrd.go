@@ -1,6 +1,12 @@
 package auditrd
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/golang/glog"
@@ -9,6 +15,8 @@ import (
 //go:generate gomodifytags -file $GOFILE -struct AuditEvent -add-tags json -w
 type AuditEvent struct {
 	Name        AuditEventType `json:"name"`
+	Timestamp   time.Time      `json:"timestamp"`
+	EventID     uint64         `json:"event_id"`
 	Arch        string         `json:"arch,omitempty"`
 	Success     string         `json:"success,omitempty"`
 	Syscall     string         `json:"syscall"`
@@ -35,8 +43,74 @@ type AuditEvent struct {
 	Cwd         string         `json:"cwd,omitempty"`
 	Exectuable  string         `json:"exectuable,omitempty"`
 	Commandline string         `json:"commandline,omitempty"`
+	Argv        []string       `json:"argv,omitempty"`
 	Path        string         `json:"path,omitempty"`
 	DestPath    string         `json:"dest_path,omitempty"`
+
+	// Socket event fields
+	Family        string `json:"family,omitempty"`
+	LocalAddress  string `json:"local_address,omitempty"`
+	LocalPort     int    `json:"local_port,omitempty"`
+	RemoteAddress string `json:"remote_address,omitempty"`
+	RemotePort    int    `json:"remote_port,omitempty"`
+	Socket        string `json:"socket,omitempty"`
+
+	// Privilege event fields
+	OldIDs       map[string]int    `json:"old_ids,omitempty"`
+	NewIDs       map[string]int    `json:"new_ids,omitempty"`
+	Capabilities *CapabilityChange `json:"capabilities,omitempty"`
+
+	// Kernel event fields
+	Operation string `json:"operation,omitempty"`
+	Module    string `json:"module,omitempty"`
+	BpfProgID int    `json:"bpf_prog_id,omitempty"`
+
+	// Type is the record type name of a user, anomaly or integrity event, like
+	// USER_LOGIN or ANOM_ABEND.
+	Type string `json:"type,omitempty"`
+
+	// User event fields
+	Acct     string   `json:"acct,omitempty"`
+	Addr     string   `json:"addr,omitempty"`
+	Grantors []string `json:"grantors,omitempty"`
+	Cmd      string   `json:"cmd,omitempty"`
+
+	// MAC event fields, the result is in Res and the object in Path
+	Permissions   []string `json:"permissions,omitempty"`
+	SourceContext string   `json:"scontext,omitempty"`
+	TargetContext string   `json:"tcontext,omitempty"`
+	Class         string   `json:"tclass,omitempty"`
+	Permissive    bool     `json:"permissive,omitempty"`
+	Profile       string   `json:"profile,omitempty"`
+
+	// Seccomp event fields, IP and Code as logged
+	Action string `json:"action,omitempty"`
+	Signal int    `json:"signal,omitempty"`
+	IP     string `json:"ip,omitempty"`
+	Code   string `json:"code,omitempty"`
+
+	// Anomaly and integrity event fields
+	Device string `json:"device,omitempty"`
+	Cause  string `json:"cause,omitempty"`
+	Hash   string `json:"hash,omitempty"`
+
+	// Config event fields, the setting changed from OldValue to Value or the
+	// list of the rule changed. Alert is set when a protected rule changes.
+	Setting  string `json:"setting,omitempty"`
+	Value    string `json:"value,omitempty"`
+	OldValue string `json:"old_value,omitempty"`
+	List     string `json:"list,omitempty"`
+	Alert    bool   `json:"alert,omitempty"`
+
+	// Target event fields, the processes traced or signalled
+	Targets []ProcessTarget `json:"targets,omitempty"`
+
+	// IPC event fields, the SysV IPC object or POSIX message queue accessed
+	IPC    *IPCObject `json:"ipc,omitempty"`
+	Mqueue *Mqueue    `json:"mqueue,omitempty"`
+
+	// Containers of the process, see the containers package
+	Containers map[string]string `json:"containers,omitempty"`
 }
 
 // AuditMessage represents a single audit message emitted from the netlink
@@ -44,9 +118,12 @@ type AuditEvent struct {
 type AuditMessage struct {
 	Type      uint16 `json:"type"`
 	Data      string `json:"data"`
-	Seq       int    `json:"-"`
+	Seq       uint64 `json:"-"`
 	AuditTime string `json:"-"`
 
+	// Timestamp is the time of the header, with millisecond precision
+	Timestamp time.Time `json:"-"`
+
 	Containers map[string]string `json:"containers,omitempty"`
 }
 
@@ -63,44 +140,349 @@ type AuditMessageTokenMap struct {
 // counter. Usually the audit message contains a starting packet and ending
 // packet and some packets in between. They represent the same event.
 type AuditMessageGroup struct {
-	Seq           int             `json:"sequence"`
-	AuditTime     string          `json:"timestamp"`
+	Seq uint64 `json:"sequence"`
+
+	// AuditTime is the time of the header as logged, Timestamp the parsed one
+	AuditTime string    `json:"timestamp"`
+	Timestamp time.Time `json:"time"`
+
 	CompleteAfter time.Time       `json:"-"`
 	Msgs          []*AuditMessage `json:"messages"`
+
+	// Gap is set on the synthetic groups, without messages, sent when the
+	// kernel overran the socket. Events were lost after Seq.
+	Gap bool `json:"gap,omitempty"`
 }
 
 func (amg *AuditMessageGroup) addMessage(am *AuditMessage) {
 	amg.Msgs = append(amg.Msgs, am)
 }
 
-// NewAuditReader returns a channel which can be read from for the
-// AuditMessageGroup which are parsed messages from the netlink socket of the
-// NETLINK_AUDIT type.
-func NewAuditReader(
-	minAuditEventType, maxAuditEventType uint16,
-	auditMessageBufferSize int,
-	recvSize int,
-) (chan *AuditMessageGroup, error) {
-	generateSyscallMap()
-	out := make(chan *AuditMessageGroup, auditMessageBufferSize)
-	marshaller := NewAuditMarshaller(out,
-		minAuditEventType, maxAuditEventType, true, false, 5)
-	nlClient, err := NewNetlinkClient(recvSize, false)
-	if err != nil {
+// READER_ERROR_QUEUE_SIZE is the number of receive errors kept for Errors,
+// further errors are only logged until the queue is read.
+const READER_ERROR_QUEUE_SIZE = 16
+
+// AuditReader reads the audit records from a Source and groups them in
+// AuditMessageGroup. It runs until its context is done or it's closed.
+type AuditReader struct {
+	source     Source
+	marshaller *auditMarshaller
+	stats      *readerStats
+
+	// recvCeiling bounds the receive buffer growth on overruns
+	recvCeiling int
+
+	events chan *AuditMessageGroup
+	errors chan error
+	cancel context.CancelFunc
+
+	// spill holds the groups waiting for room in events, with the
+	// BackpressureSpill policy.
+	spill   *spillQueue
+	workers sync.WaitGroup
+
+	// done is closed once the reader goroutine exited and the channels are
+	// closed.
+	done      chan struct{}
+	closeOnce sync.Once
+	closeErr  error
+}
+
+// NewAuditReader starts reading the audit messages from the netlink socket of
+// the NETLINK_AUDIT type. Without options it groups the 1100-1400 records, see
+// the ReaderOption functions to change it. The reader stops when ctx is done or
+// Close is called.
+func NewAuditReader(ctx context.Context, opts ...ReaderOption) (*AuditReader, error) {
+	config := defaultReaderConfig()
+	for _, opt := range opts {
+		opt(config)
+	}
+
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+
+	nlClient := config.client
+	if nlClient == nil {
+		if config.multicast {
+			if err := CheckMulticastSupport(); err != nil {
+				return nil, err
+			}
+		}
+
+		var err error
+		if nlClient, err = NewNetlinkClient(config.recvSize, config.multicast); err != nil {
+			return nil, err
+		}
+	}
+
+	r, err := newReader(ctx, NewNetlinkSource(nlClient), config)
+	if err != nil && config.client == nil {
+		nlClient.Close()
+	}
+	return r, err
+}
+
+// NewSourceReader starts grouping the audit records read from the source, the
+// reader owns the source and closes it when it stops. The options selecting a
+// netlink socket, such as WithMulticast or WithClient, are ignored.
+func NewSourceReader(ctx context.Context, src Source, opts ...ReaderOption) (*AuditReader, error) {
+	config := defaultReaderConfig()
+	for _, opt := range opts {
+		opt(config)
+	}
+
+	if err := config.validate(); err != nil {
 		return nil, err
 	}
 
+	return newReader(ctx, src, config)
+}
+
+func newReader(ctx context.Context, src Source, config *readerConfig) (*AuditReader, error) {
+	var spill *spillQueue
+	if config.backpressure == BackpressureSpill {
+		var err error
+		if spill, err = newSpillQueue(config.spillDir, config.spillSize); err != nil {
+			return nil, err
+		}
+	}
+
+	generateSyscallMap()
+	ctx, cancel := context.WithCancel(ctx)
+	r := &AuditReader{
+		source: src,
+		events: make(chan *AuditMessageGroup, config.bufferSize),
+		errors: make(chan error, READER_ERROR_QUEUE_SIZE),
+		cancel: cancel,
+		spill:  spill,
+		done:   make(chan struct{}),
+	}
+	r.marshaller = NewAuditMarshaller(r.events, 0, 0, config.trackMessages,
+		config.logOutOfOrder, config.outOfOrderWindow)
+	r.marshaller.recordTypes = config.recordTypes
+	r.marshaller.completeAfter = config.reassemblyTimeout
+	r.marshaller.done = ctx.Done()
+	r.marshaller.backpressure = config.backpressure
+	r.marshaller.spill = spill
+	r.recvCeiling = config.recvCeiling
+	r.stats = r.marshaller.stats
+	r.stats.metrics = config.metrics
+
+	if spill != nil {
+		r.workers.Add(1)
+		go r.drainSpill(ctx)
+	}
+	go r.run(ctx)
+	if _, ok := r.source.(statusSource); ok {
+		go r.pollKernelStatus(ctx)
+	}
 	go func() {
-		for {
-			msg, err := nlClient.Receive()
-			if err != nil {
-				glog.Error("Failed to read message", err)
+		select {
+		case <-ctx.Done():
+			r.shutdown()
+		case <-r.done:
+		}
+	}()
+
+	return r, nil
+}
+
+// Events returns the channel of the audit message groups. It's closed when the
+// reader stops.
+func (r *AuditReader) Events() <-chan *AuditMessageGroup {
+	return r.events
+}
+
+// Errors returns the channel of the errors met while receiving. It's closed
+// when the reader stops.
+func (r *AuditReader) Errors() <-chan error {
+	return r.errors
+}
+
+// Close stops the reader, closes the source and waits for the channels to be
+// closed. The audit pid is released if the reader registered it.
+func (r *AuditReader) Close() error {
+	r.cancel()
+	r.shutdown()
+	<-r.done
+	return r.closeErr
+}
+
+// shutdown closes the source, which makes Next return io.EOF and the reader
+// goroutine exit.
+func (r *AuditReader) shutdown() {
+	r.closeOnce.Do(func() {
+		r.closeErr = r.source.Close()
+	})
+}
+
+func (r *AuditReader) run(ctx context.Context) {
+	defer close(r.done)
+	defer close(r.errors)
+	defer close(r.events)
+	defer func() {
+		// Stop the spill drainer before closing events
+		r.cancel()
+		r.workers.Wait()
+		if r.spill != nil {
+			r.spill.close()
+		}
+	}()
+
+	for {
+		msg, err := r.source.Next()
+		if err == io.EOF {
+			break
+		}
+
+		if ctx.Err() != nil {
+			// Drain the source until it's closed, nobody is reading anymore
+			continue
+		}
+
+		if err == syscall.ENOBUFS {
+			r.overrun()
+		}
+
+		if errors.Is(err, ErrLineTooLong) {
+			r.stats.inc(&r.stats.linesTooLong, r.stats.metrics.LinesTooLong)
+		}
+
+		if err != nil {
+			r.reportError(err)
+			continue
+		}
+
+		r.marshaller.ProcessMessage(msg)
+	}
+
+	if ctx.Err() == nil {
+		// The source stopped on its own, at the end of a log file for
+		// example, nothing else will complete the pending groups.
+		r.marshaller.flushAll()
+	}
+
+	// The source may have stopped on its own
+	r.shutdown()
+}
+
+// drainSpill writes the spilled groups to events as the consumer catches up.
+// The groups still spilled when the reader stops are lost.
+func (r *AuditReader) drainSpill(ctx context.Context) {
+	defer r.workers.Done()
+
+	for {
+		g, discarded, err := r.spill.pop()
+		if err != nil {
+			glog.Errorf("Failed to read the spilled message groups, %d dropped: %s", discarded, err)
+			for i := 0; i < discarded; i++ {
+				r.stats.inc(&r.stats.dropped, r.stats.metrics.Dropped)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			default:
+			}
+			continue
+		}
+
+		if g == nil {
+			select {
+			case <-r.spill.ready:
 				continue
+			case <-ctx.Done():
+				return
 			}
+		}
 
-			marshaller.Process(msg)
+		select {
+		case r.events <- g:
+			r.stats.inc(&r.stats.groupsEmitted, r.stats.metrics.GroupsEmitted)
+			r.spill.delivered()
+		case <-ctx.Done():
+			return
 		}
-	}()
+	}
+}
+
+// overrun tells the consumer that events were lost and grows the receive buffer
+// if a ceiling was set.
+func (r *AuditReader) overrun() {
+	r.stats.inc(&r.stats.overruns, r.stats.metrics.Overruns)
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	r.marshaller.emit(&AuditMessageGroup{
+		Seq:       r.marshaller.lastSeq,
+		Timestamp: now,
+		AuditTime: auditTime(now),
+		Gap:       true,
+	})
+
+	g, ok := r.source.(growableSource)
+	if !ok || r.recvCeiling <= 0 {
+		return
+	}
+
+	size, err := g.GrowReceiveBuffer(r.recvCeiling)
+	if err != nil {
+		glog.Error("Failed to grow the receive buffer: ", err)
+		return
+	}
+
+	glog.V(1).Infoln("Socket receive buffer size:", size)
+}
+
+// auditTime formats a time like the audit header timestamps
+func auditTime(t time.Time) string {
+	return fmt.Sprintf("%d.%03d", t.Unix(), t.Nanosecond()/int(time.Millisecond))
+}
+
+// Stats returns a snapshot of the reader counters without any request to the
+// kernel, the kernel lost counter is the one polled every
+// KERNEL_STATUS_INTERVAL when the source reads from the kernel.
+func (r *AuditReader) Stats() Stats {
+	return r.stats.snapshot()
+}
+
+func (r *AuditReader) updateKernelLost() {
+	s, ok := r.source.(statusSource)
+	if !ok {
+		return
+	}
+
+	status, err := s.GetStatus()
+	if err != nil {
+		glog.V(2).Infoln("Failed to read the audit status:", err)
+		return
+	}
+
+	r.stats.setKernelLost(status.Lost)
+}
 
-	return out, nil
+// pollKernelStatus keeps the KernelLost gauge up to date until the reader stops
+func (r *AuditReader) pollKernelStatus(ctx context.Context) {
+	ticker := time.NewTicker(KERNEL_STATUS_INTERVAL)
+	defer ticker.Stop()
+
+	for {
+		r.updateKernelLost()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-r.done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// reportError queues a receive error for Errors without blocking the reader
+func (r *AuditReader) reportError(err error) {
+	select {
+	case r.errors <- err:
+	default:
+		glog.Error("Failed to read message: ", err)
+	}
 }
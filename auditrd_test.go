@@ -0,0 +1,300 @@
+package auditrd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// fakeClient feeds the queued messages to the reader, only Receive, Close and
+// the status used by the reader are implemented.
+type fakeClient struct {
+	Client
+
+	messages  chan receiveResult
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+func newFakeClient() *fakeClient {
+	return &fakeClient{
+		messages: make(chan receiveResult, RECEIVE_QUEUE_SIZE),
+		closed:   make(chan struct{}),
+	}
+}
+
+func (f *fakeClient) Receive() (*syscall.NetlinkMessage, error) {
+	select {
+	case r := <-f.messages:
+		return r.msg, r.err
+	case <-f.closed:
+		return nil, ErrClientClosed
+	}
+}
+
+func (f *fakeClient) GetStatus() (*AuditStatus, error) {
+	return nil, errors.New("No audit status")
+}
+
+func (f *fakeClient) Close() error {
+	f.closeOnce.Do(func() { close(f.closed) })
+	return nil
+}
+
+func eoe(seq uint32) *syscall.NetlinkMessage {
+	m := msg1300()
+	m.Header.Type = EVENT_EOE
+	m.Header.Seq = seq
+	return m
+}
+
+func TestAuditReaderEvents(t *testing.T) {
+	c := newFakeClient()
+	rd, err := NewAuditReader(context.Background(), WithBufferSize(10),
+		WithClient(c))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	readErr := errors.New("read failed")
+	c.messages <- receiveResult{err: readErr}
+	c.messages <- receiveResult{msg: msg1300()}
+	c.messages <- receiveResult{msg: msg1307()}
+	c.messages <- receiveResult{msg: eoe(1)}
+
+	select {
+	case msg := <-rd.Events():
+		if msg.Seq != 49129 || len(msg.Msgs) != 2 {
+			t.Errorf("Unexpected message group %+v", msg)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Timed out waiting for the event")
+	}
+
+	if err := <-rd.Errors(); err != readErr {
+		t.Errorf("Expected the read error, got %v", err)
+	}
+
+	if err := rd.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := <-rd.Events(); ok {
+		t.Error("Events should be closed")
+	}
+	if _, ok := <-rd.Errors(); ok {
+		t.Error("Errors should be closed")
+	}
+}
+
+func TestAuditReaderContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	// Readers are independent, stopping one leaves the other running
+	c1, c2 := newFakeClient(), newFakeClient()
+	rd1, err := NewAuditReader(ctx, WithBufferSize(0), WithClient(c1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rd2, err := NewAuditReader(context.Background(), WithBufferSize(0),
+		WithClient(c2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rd2.Close()
+
+	// Nobody reads the unbuffered events, the pending write must not block
+	// the shutdown.
+	c1.messages <- receiveResult{msg: msg1300()}
+	c1.messages <- receiveResult{msg: eoe(1)}
+	cancel()
+
+	select {
+	case <-rd1.done:
+	case <-time.After(time.Second):
+		t.Fatal("Reader did not stop with its context")
+	}
+
+	select {
+	case <-c1.closed:
+	default:
+		t.Error("Client should be closed")
+	}
+
+	select {
+	case <-c2.closed:
+		t.Error("Other reader's client should be left open")
+	default:
+	}
+
+	if err := rd1.Close(); err != nil {
+		t.Errorf("Closing twice should not fail, got %v", err)
+	}
+}
+
+func TestAuditReaderInvalidOptions(t *testing.T) {
+	opts := [][]ReaderOption{
+		{WithRecordTypes()},
+		{WithRecordTypes(RecordTypeRange{Min: 1399, Max: 1300})},
+		{WithReassemblyTimeout(0)},
+		{WithOutOfOrderWindow(-1)},
+		{WithBufferSize(-1)},
+	}
+
+	for _, o := range opts {
+		c := newFakeClient()
+		if _, err := NewAuditReader(context.Background(),
+			append(o, WithClient(c))...); err == nil {
+			t.Errorf("Expected an error for options %v", o)
+		}
+	}
+}
+
+type fakeCounter struct {
+	value float64
+}
+
+func (c *fakeCounter) Add(v float64) {
+	c.value += v
+}
+
+// statusClient reports a kernel lost counter
+type statusClient struct {
+	*fakeClient
+	lost uint32
+}
+
+func (s *statusClient) GetStatus() (*AuditStatus, error) {
+	return &AuditStatus{Lost: s.lost}, nil
+}
+
+func cwdRecord(seq int) *syscall.NetlinkMessage {
+	m := msg1307()
+	m.Data = []byte(fmt.Sprintf(`audit(1621634984.633:%d): cwd="/etc"`, seq))
+	return m
+}
+
+func TestAuditReaderStats(t *testing.T) {
+	c := &statusClient{fakeClient: newFakeClient(), lost: 3}
+	missed := &fakeCounter{}
+	rd, err := NewAuditReader(context.Background(), WithClient(c),
+		WithMetrics(Metrics{SequencesMissed: missed}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rd.Close()
+
+	// 2 comes late, 4 is never received
+	for _, seq := range []int{1, 3, 2, 10} {
+		c.messages <- receiveResult{msg: cwdRecord(seq)}
+	}
+	eoe := msg1320()
+	eoe.Data = []byte(`audit(1621634984.633:10): `)
+	c.messages <- receiveResult{msg: eoe}
+	c.messages <- receiveResult{err: syscall.ENOBUFS}
+
+	<-rd.Events()
+	<-rd.Errors()
+
+	// The kernel lost counter comes from the status poller, not from Stats
+	s := rd.Stats()
+	for deadline := time.Now().Add(time.Second); s.KernelLost == 0 && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+		s = rd.Stats()
+	}
+	expected := Stats{
+		MessagesReceived: 5,
+		GroupsEmitted:    2, // The event and the gap
+		GroupsEnded:      1,
+		SequencesMissed:  1,
+		OutOfOrder:       1,
+		Overruns:         1,
+		KernelLost:       3,
+	}
+	if s != expected {
+		t.Errorf("Expected %+v, got %+v", expected, s)
+	}
+
+	if missed.value != 1 {
+		t.Errorf("Expected the missed counter to be 1, got %v", missed.value)
+	}
+}
+
+// growClient records the receive buffer growth asked by the reader
+type growClient struct {
+	*fakeClient
+	ceilings chan int
+}
+
+func (g *growClient) GrowReceiveBuffer(ceiling int) (int, error) {
+	g.ceilings <- ceiling
+	return ceiling, nil
+}
+
+func TestAuditReaderOverrun(t *testing.T) {
+	c := &growClient{fakeClient: newFakeClient(), ceilings: make(chan int, 1)}
+	rd, err := NewAuditReader(context.Background(), WithClient(c),
+		WithReceiveBufferCeiling(1<<20))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rd.Close()
+
+	c.messages <- receiveResult{msg: cwdRecord(7)}
+	c.messages <- receiveResult{err: syscall.ENOBUFS}
+
+	select {
+	case msg := <-rd.Events():
+		if !msg.Gap || msg.Seq != 7 || len(msg.Msgs) != 0 {
+			t.Errorf("Expected a gap after sequence 7, got %+v", msg)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Timed out waiting for the gap")
+	}
+
+	if err := <-rd.Errors(); err != syscall.ENOBUFS {
+		t.Errorf("Expected ENOBUFS, got %v", err)
+	}
+
+	if ceiling := <-c.ceilings; ceiling != 1<<20 {
+		t.Errorf("Expected the buffer to grow up to 1MiB, got %d", ceiling)
+	}
+}
+
+func TestAuditReaderSpill(t *testing.T) {
+	c := &statusClient{fakeClient: newFakeClient()}
+	rd, err := NewAuditReader(context.Background(), WithClient(c),
+		WithBufferSize(1), WithSpill(t.TempDir(), 1<<20),
+		WithReassemblyTimeout(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rd.Close()
+
+	// Nothing reads the events until all the groups are complete
+	for seq := 1; seq <= 5; seq++ {
+		c.messages <- receiveResult{msg: cwdRecord(seq)}
+		eoe := msg1320()
+		eoe.Data = []byte(fmt.Sprintf(`audit(1621634984.633:%d): `, seq))
+		c.messages <- receiveResult{msg: eoe}
+	}
+
+	for seq := uint64(1); seq <= 5; seq++ {
+		select {
+		case g := <-rd.Events():
+			if g.Seq != seq || len(g.Msgs) != 1 || g.Msgs[0].Data != `cwd="/etc"` {
+				t.Errorf("Expected group %d, got %+v", seq, g)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Timed out waiting for group %d", seq)
+		}
+	}
+
+	if s := rd.Stats(); s.Spilled == 0 || s.Dropped != 0 {
+		t.Errorf("Unexpected stats %+v", s)
+	}
+}
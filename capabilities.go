@@ -0,0 +1,88 @@
+package auditrd
+
+import (
+	"strconv"
+)
+
+// CapabilitySet is a bitmask of capabilities, bit n being capability n
+type CapabilitySet uint64
+
+// capabilityNames are the names of the capabilities by number, see
+// include/uapi/linux/capability.h
+var capabilityNames = []string{
+	"cap_chown",
+	"cap_dac_override",
+	"cap_dac_read_search",
+	"cap_fowner",
+	"cap_fsetid",
+	"cap_kill",
+	"cap_setgid",
+	"cap_setuid",
+	"cap_setpcap",
+	"cap_linux_immutable",
+	"cap_net_bind_service",
+	"cap_net_broadcast",
+	"cap_net_admin",
+	"cap_net_raw",
+	"cap_ipc_lock",
+	"cap_ipc_owner",
+	"cap_sys_module",
+	"cap_sys_rawio",
+	"cap_sys_chroot",
+	"cap_sys_ptrace",
+	"cap_sys_pacct",
+	"cap_sys_admin",
+	"cap_sys_boot",
+	"cap_sys_nice",
+	"cap_sys_resource",
+	"cap_sys_time",
+	"cap_sys_tty_config",
+	"cap_mknod",
+	"cap_lease",
+	"cap_audit_write",
+	"cap_audit_control",
+	"cap_setfcap",
+	"cap_mac_override",
+	"cap_mac_admin",
+	"cap_syslog",
+	"cap_wake_alarm",
+	"cap_block_suspend",
+	"cap_audit_read",
+	"cap_perfmon",
+	"cap_bpf",
+	"cap_checkpoint_restore",
+}
+
+// Names returns the names of the capabilities in the set, the ones unknown to
+// this package are named by number like cap_41.
+func (c CapabilitySet) Names() []string {
+	var names []string
+	for n := 0; n < 64; n++ {
+		if c&(1<<n) == 0 {
+			continue
+		}
+
+		if n < len(capabilityNames) {
+			names = append(names, capabilityNames[n])
+		} else {
+			names = append(names, "cap_"+strconv.Itoa(n))
+		}
+	}
+	return names
+}
+
+// CapabilityChange holds the capability sets of a privilege event by name.
+// Capset sets Permitted, Inheritable, Effective and Ambient, an exec raising
+// capabilities through file capabilities sets the old and file sets too.
+type CapabilityChange struct {
+	Permitted       []string `json:"permitted"`
+	Inheritable     []string `json:"inheritable"`
+	Effective       []string `json:"effective"`
+	Ambient         []string `json:"ambient,omitempty"`
+	OldPermitted    []string `json:"old_permitted,omitempty"`
+	OldInheritable  []string `json:"old_inheritable,omitempty"`
+	OldEffective    []string `json:"old_effective,omitempty"`
+	OldAmbient      []string `json:"old_ambient,omitempty"`
+	FilePermitted   []string `json:"file_permitted,omitempty"`
+	FileInheritable []string `json:"file_inheritable,omitempty"`
+}
@@ -7,6 +7,10 @@ import (
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
 	"sync/atomic"
 	"syscall"
 	"time"
@@ -34,7 +38,7 @@ type auditStatusPayload struct {
 	BacklogLimit    uint32
 	Lost            uint32
 	Backlog         uint32
-	Version         uint32
+	Version         uint32 // feature_bitmap on newer kernels
 	BacklogWaitTime uint32
 }
 
@@ -45,32 +49,99 @@ type netlinkPacket syscall.NlMsghdr
 type Client interface {
 	Send(*netlinkPacket, *auditStatusPayload) error
 	Receive() (*syscall.NetlinkMessage, error)
+	Request(*NetlinkRequest) ([]*syscall.NetlinkMessage, error)
+
+	// Audit rule management
+	AddRule(*AuditRule) error
+	DeleteRule(*AuditRule) error
+	ListRules() ([]*AuditRule, error)
+	FlushRules() error
+
+	// Audit status query and control
+	GetStatus() (*AuditStatus, error)
+	SetEnabled(uint32) error
+	SetFailure(uint32) error
+	SetPid(uint32) error
+	SetRateLimit(uint32) error
+	SetBacklogLimit(uint32) error
+	SetBacklogWaitTime(uint32) error
+	ResetLost() error
+
+	// GrowReceiveBuffer doubles the socket receive buffer, up to ceiling
+	// bytes, and returns the new size.
+	GrowReceiveBuffer(ceiling int) (int, error)
+
+	// Close releases the audit pid if the client registered it and closes
+	// the socket.
+	Close() error
 }
 
 type netlinkClient struct {
 	fd      int
+	file    *os.File
+	conn    syscall.RawConn
 	address syscall.Sockaddr
 	seq     uint32
 	buf     []byte
+
+	// keepPid is set when the client registers itself as the audit pid
+	keepPid bool
+
+	// Requests waiting for a reply, by sequence number
+	mu      sync.Mutex
+	pending map[uint32]*pendingRequest
+
+	// Audit events read from the socket waiting for Receive
+	messages chan receiveResult
+
+	// done is closed when the client is closed, keepalive stops the worker
+	// keeping the audit pid.
+	done      chan struct{}
+	keepalive chan struct{}
+	workers   sync.WaitGroup
+	closeOnce sync.Once
+	closeErr  error
+}
+
+// receiveResult is a message or an error read from the socket
+type receiveResult struct {
+	msg *syscall.NetlinkMessage
+	err error
 }
 
+// RECEIVE_QUEUE_SIZE is the number of audit events read off the socket ahead
+// of Receive.
+const RECEIVE_QUEUE_SIZE = 64
+
 // NewNetlinkClient creates a client to the audit netlink socket to read the
 // audit logs. This accepts a parameter, readonly, which tells the client to
 // bind it's PID or not not. If the client does not bind it's PID, it needs to
 // connect to the socket in the read only group. Note that this flag should only
 // be used in Linux Kernel version v3.16 or above.
 func NewNetlinkClient(recvSize int, readonly bool) (Client, error) {
+	var groups uint32 = 0
+	if readonly {
+		groups = AUDIT_NLGRP_READLOG
+	}
+
+	return newNetlinkClient(recvSize, groups, !readonly)
+}
+
+// NewControlClient creates a client to the audit netlink socket to manage the
+// rules and the status only. It neither joins the multicast group nor
+// registers as the audit pid, so it receives no audit events and can run
+// alongside auditd or an audit reader.
+func NewControlClient() (Client, error) {
+	return newNetlinkClient(0, 0, false)
+}
+
+func newNetlinkClient(recvSize int, groups uint32, keepPid bool) (Client, error) {
 	fd, err := syscall.Socket(
 		syscall.AF_NETLINK, syscall.SOCK_RAW, syscall.NETLINK_AUDIT)
 	if err != nil {
 		return nil, fmt.Errorf("Could not create a socket: %s", err)
 	}
 
-	var groups uint32 = 0
-	if readonly {
-		groups = AUDIT_NLGRP_READLOG
-	}
-
 	n := &netlinkClient{
 		fd: fd,
 		address: &syscall.SockaddrNetlink{
@@ -78,11 +149,20 @@ func NewNetlinkClient(recvSize int, readonly bool) (Client, error) {
 			Groups: groups,
 			Pid:    0,
 		},
-		buf: make([]byte, MAX_AUDIT_MESSAGE_LENGTH),
+		buf:       make([]byte, MAX_AUDIT_MESSAGE_LENGTH),
+		keepPid:   keepPid,
+		pending:   make(map[uint32]*pendingRequest),
+		messages:  make(chan receiveResult, RECEIVE_QUEUE_SIZE),
+		done:      make(chan struct{}),
+		keepalive: make(chan struct{}),
 	}
 
 	if err = syscall.Bind(fd, n.address); err != nil {
 		syscall.Close(fd)
+		if groups != 0 && err == syscall.EPERM {
+			return nil, fmt.Errorf(
+				"Could not join the audit multicast group, CAP_AUDIT_READ is required: %s", err)
+		}
 		return nil, fmt.Errorf("Could not bind to netlink socket: %s", err)
 	}
 
@@ -102,14 +182,34 @@ func NewNetlinkClient(recvSize int, readonly bool) (Client, error) {
 		glog.V(2).Infoln("Socket receive buffer size:", v)
 	}
 
-	if !readonly {
-		// If a readonly connection is needed and supported, don't run the keep
-		// connection worker.
+	// Reads go through the runtime poller so that closing the file wakes up a
+	// blocked receive.
+	if err = syscall.SetNonblock(fd, true); err != nil {
+		syscall.Close(fd)
+		return nil, fmt.Errorf("Could not make the socket non blocking: %s", err)
+	}
+	n.file = os.NewFile(uintptr(fd), "audit-netlink")
+	if n.conn, err = n.file.SyscallConn(); err != nil {
+		n.file.Close()
+		return nil, err
+	}
+
+	go n.receiveLoop()
+
+	if keepPid {
+		// Readonly and control clients don't run the keep connection worker
+		n.workers.Add(1)
 		go func() {
+			defer n.workers.Done()
 			for {
 				// Attempt to keep the audit connection
 				n.KeepConnection()
-				time.Sleep(time.Second * 5)
+
+				select {
+				case <-n.keepalive:
+					return
+				case <-time.After(time.Second * 5):
+				}
 			}
 		}()
 	}
@@ -117,46 +217,163 @@ func NewNetlinkClient(recvSize int, readonly bool) (Client, error) {
 	return n, nil
 }
 
+// CheckMulticastSupport returns an error if the running kernel can't deliver
+// the audit events to the AUDIT_NLGRP_READLOG multicast group, which was added
+// in Linux v3.16.
+func CheckMulticastSupport() error {
+	var uts syscall.Utsname
+	if err := syscall.Uname(&uts); err != nil {
+		return fmt.Errorf("Could not get the kernel version: %s", err)
+	}
+
+	release := make([]byte, 0, len(uts.Release))
+	for _, c := range uts.Release {
+		if c == 0 {
+			break
+		}
+		release = append(release, byte(c))
+	}
+
+	major, minor, ok := parseKernelVersion(string(release))
+	if !ok {
+		return fmt.Errorf("Could not parse the kernel version %q", release)
+	}
+
+	if major < 3 || (major == 3 && minor < 16) {
+		return fmt.Errorf(
+			"Audit multicast needs Linux v3.16 or above, running %s", release)
+	}
+
+	return nil
+}
+
+// parseKernelVersion gets the major and minor version out of a kernel release
+// such as 5.4.0-74-generic.
+func parseKernelVersion(release string) (major, minor int, ok bool) {
+	parts := strings.SplitN(release, ".", 3)
+	if len(parts) < 2 {
+		return 0, 0, false
+	}
+
+	var err error
+	if major, err = strconv.Atoi(parts[0]); err != nil {
+		return 0, 0, false
+	}
+
+	// The minor version may be followed by a suffix, e.g. 4.19-rc1
+	end := 0
+	for end < len(parts[1]) && parts[1][end] >= '0' && parts[1][end] <= '9' {
+		end++
+	}
+	if minor, err = strconv.Atoi(parts[1][:end]); err != nil {
+		return 0, 0, false
+	}
+
+	return major, minor, true
+}
+
 // Send will send a packet and payload to the netlink socket without waiting for
 // a response
 func (n *netlinkClient) Send(np *netlinkPacket, a *auditStatusPayload) error {
-	//We need to get the length first. This is a bit wasteful, but requests are
-	//rare so yolo..
 	buf := new(bytes.Buffer)
-	var length int
-
-	np.Seq = atomic.AddUint32(&n.seq, 1)
+	binary.Write(buf, endianness, a)
+	return n.send(np, buf.Bytes())
+}
 
-	for {
-		buf.Reset()
-		binary.Write(buf, endianness, np)
-		binary.Write(buf, endianness, a)
-		if np.Len == 0 {
-			length = len(buf.Bytes())
-			np.Len = uint32(length)
-		} else {
-			break
-		}
+// send writes a netlink header followed by a raw payload to the socket. The
+// sequence number and length of the packet are filled in.
+func (n *netlinkClient) send(np *netlinkPacket, payload []byte) error {
+	if np.Seq == 0 {
+		np.Seq = atomic.AddUint32(&n.seq, 1)
 	}
+	np.Len = uint32(syscall.SizeofNlMsghdr + len(payload))
 
-	if err := syscall.Sendto(n.fd, buf.Bytes(), 0, n.address); err != nil {
-		return err
+	buf := new(bytes.Buffer)
+	binary.Write(buf, endianness, np)
+	buf.Write(payload)
+
+	var serr error
+	err := n.conn.Write(func(fd uintptr) bool {
+		serr = syscall.Sendto(int(fd), buf.Bytes(), 0, n.address)
+		return serr != syscall.EAGAIN
+	})
+	if err != nil {
+		return ErrClientClosed
 	}
 
-	return nil
+	return serr
 }
 
-// Receive will receive a packet from a netlink socket
+// Receive returns the next audit event read from the socket. Replies to
+// requests are never returned here. Once the client is closed ErrClientClosed
+// is returned.
 func (n *netlinkClient) Receive() (*syscall.NetlinkMessage, error) {
-	nlen, _, err := syscall.Recvfrom(n.fd, n.buf, 0)
+	r, ok := <-n.messages
+	if !ok {
+		return nil, ErrClientClosed
+	}
+
+	return r.msg, r.err
+}
+
+// receiveLoop reads everything sent to the socket, hands the replies to the
+// requests waiting for them and queues the audit events for Receive. A client
+// receiving events must be read from, a control client receives none.
+func (n *netlinkClient) receiveLoop() {
+	defer close(n.messages)
+
+	for {
+		msg, err := n.read()
+		if err == ErrClientClosed {
+			n.failPending(err)
+			return
+		}
+
+		if err == nil && n.dispatch(msg) {
+			continue
+		}
+
+		select {
+		case n.messages <- receiveResult{msg: msg, err: err}:
+		case <-n.done:
+			n.failPending(ErrClientClosed)
+			return
+		}
+
+		if err != nil && err != syscall.ENOBUFS && err != syscall.EINTR && err != errShortPacket {
+			// Anything but an overrun, an interruption or a bad packet is
+			// fatal
+			n.failPending(err)
+			return
+		}
+	}
+}
+
+// errShortPacket is returned for a packet without a complete netlink header,
+// the packet is skipped and reading goes on.
+var errShortPacket = errors.New("Got a short packet")
+
+// read reads a single message from the socket
+func (n *netlinkClient) read() (*syscall.NetlinkMessage, error) {
+	var nlen int
+	var rerr error
+	err := n.conn.Read(func(fd uintptr) bool {
+		nlen, _, rerr = syscall.Recvfrom(int(fd), n.buf, 0)
+		return rerr != syscall.EAGAIN
+	})
 	if err != nil {
-		return nil, err
+		return nil, ErrClientClosed
 	}
 
-	if nlen < 1 {
-		return nil, errors.New("Got a 0 length packet")
+	if rerr != nil {
+		return nil, rerr
 	}
 
+	if nlen < syscall.SizeofNlMsghdr {
+		return nil, errShortPacket
+	}
+
+	// The read buffer is reused, the message gets its own copy of the data
 	msg := &syscall.NetlinkMessage{
 		Header: syscall.NlMsghdr{
 			Len:   endianness.Uint32(n.buf[0:4]),
@@ -165,7 +382,7 @@ func (n *netlinkClient) Receive() (*syscall.NetlinkMessage, error) {
 			Seq:   endianness.Uint32(n.buf[8:12]),
 			Pid:   endianness.Uint32(n.buf[12:16]),
 		},
-		Data: n.buf[syscall.SizeofNlMsghdr:nlen],
+		Data: append([]byte(nil), n.buf[syscall.SizeofNlMsghdr:nlen]...),
 	}
 
 	return msg, nil
@@ -173,21 +390,158 @@ func (n *netlinkClient) Receive() (*syscall.NetlinkMessage, error) {
 
 // KeepConnection re-establishes our connection to the netlink socket
 func (n *netlinkClient) KeepConnection() {
-	payload := &auditStatusPayload{
-		Mask:    4,
-		Enabled: 1,
-		Pid:     uint32(syscall.Getpid()),
-		//TODO: Failure: http://lxr.free-electrons.com/source/include/uapi/linux/audit.h#L338
+	pid := uint32(syscall.Getpid())
+	err := n.SetPid(pid)
+	if err == syscall.EEXIST {
+		// The kernel refuses to replace a healthy audit daemon, which may
+		// very well be us.
+		if s, serr := n.GetStatus(); serr == nil && s.Pid == pid {
+			return
+		}
 	}
 
-	packet := &netlinkPacket{
-		Type:  uint16(1001),
-		Flags: syscall.NLM_F_REQUEST | syscall.NLM_F_ACK,
-		Pid:   uint32(syscall.Getpid()),
+	if err != nil {
+		glog.Error("Error occurred while trying to keep the connection:", err)
 	}
+}
+
+// GrowReceiveBuffer doubles the socket receive buffer up to ceiling bytes, it
+// uses SO_RCVBUFFORCE when the process has CAP_NET_ADMIN. Otherwise the size is
+// capped by net.core.rmem_max. The new size is returned.
+func (n *netlinkClient) GrowReceiveBuffer(ceiling int) (int, error) {
+	var size int
+	var serr error
+	err := n.conn.Control(func(fd uintptr) {
+		var current int
+		current, serr = syscall.GetsockoptInt(
+			int(fd), syscall.SOL_SOCKET, syscall.SO_RCVBUF)
+		if serr != nil || current >= ceiling {
+			size = current
+			return
+		}
+
+		want := current * 2
+		if want > ceiling {
+			want = ceiling
+		}
 
-	err := n.Send(packet, payload)
+		// The kernel doubles the requested value to account for its overhead
+		// and reports the doubled value.
+		serr = syscall.SetsockoptInt(
+			int(fd), syscall.SOL_SOCKET, syscall.SO_RCVBUFFORCE, want/2)
+		if serr == syscall.EPERM {
+			serr = syscall.SetsockoptInt(
+				int(fd), syscall.SOL_SOCKET, syscall.SO_RCVBUF, want/2)
+		}
+		if serr != nil {
+			size = current
+			return
+		}
+
+		size, serr = syscall.GetsockoptInt(
+			int(fd), syscall.SOL_SOCKET, syscall.SO_RCVBUF)
+	})
 	if err != nil {
-		glog.Error("Error occurred while trying to keep the connection:", err)
+		return 0, ErrClientClosed
 	}
+
+	return size, serr
+}
+
+// Close stops the keep connection worker, releases the audit pid if this
+// client registered it and closes the socket. A blocked Receive returns
+// ErrClientClosed.
+func (n *netlinkClient) Close() error {
+	n.closeOnce.Do(func() {
+		close(n.keepalive)
+		n.workers.Wait()
+
+		if n.keepPid {
+			_, err := n.Request(&NetlinkRequest{
+				Type:    AUDIT_SET,
+				Payload: releasePidPayload(),
+				Timeout: time.Second,
+			})
+			if err != nil && err != syscall.EACCES {
+				// EACCES means another process holds the pid
+				glog.Warning("Failed to release the audit pid: ", err)
+			}
+		}
+
+		close(n.done)
+		n.closeErr = n.file.Close()
+	})
+
+	return n.closeErr
+}
+
+// releasePidPayload builds the AUDIT_SET payload unregistering the audit pid
+func releasePidPayload() []byte {
+	buf := new(bytes.Buffer)
+	binary.Write(buf, endianness, &auditStatusPayload{Mask: AUDIT_STATUS_PID})
+	return buf.Bytes()
+}
+
+// AddRule installs an audit rule in the kernel
+func (n *netlinkClient) AddRule(r *AuditRule) error {
+	data, err := r.marshal()
+	if err != nil {
+		return err
+	}
+
+	_, err = n.Request(&NetlinkRequest{Type: AUDIT_ADD_RULE, Payload: data})
+	return err
+}
+
+// DeleteRule removes an audit rule from the kernel. The kernel only deletes a
+// rule that matches exactly, including the order of the fields.
+func (n *netlinkClient) DeleteRule(r *AuditRule) error {
+	data := r.raw
+	if data == nil {
+		var err error
+		if data, err = r.marshal(); err != nil {
+			return err
+		}
+	}
+
+	_, err := n.Request(&NetlinkRequest{Type: AUDIT_DEL_RULE, Payload: data})
+	return err
+}
+
+// ListRules returns all the audit rules currently loaded in the kernel
+func (n *netlinkClient) ListRules() ([]*AuditRule, error) {
+	replies, err := n.Request(&NetlinkRequest{
+		Type:      AUDIT_LIST_RULES,
+		ReplyType: AUDIT_LIST_RULES,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	rules := make([]*AuditRule, 0, len(replies))
+	for _, msg := range replies {
+		r, err := unmarshalAuditRule(msg.Data)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, r)
+	}
+
+	return rules, nil
+}
+
+// FlushRules deletes all the audit rules loaded in the kernel
+func (n *netlinkClient) FlushRules() error {
+	rules, err := n.ListRules()
+	if err != nil {
+		return err
+	}
+
+	for _, r := range rules {
+		if err := n.DeleteRule(r); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
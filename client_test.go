@@ -0,0 +1,25 @@
+package auditrd
+
+import "testing"
+
+func TestParseKernelVersion(t *testing.T) {
+	tests := []struct {
+		release      string
+		major, minor int
+		ok           bool
+	}{
+		{"5.4.0-74-generic", 5, 4, true},
+		{"3.16.0", 3, 16, true},
+		{"4.19-rc1", 4, 19, true},
+		{"3.10.0-1160.el7.x86_64", 3, 10, true},
+		{"linux", 0, 0, false},
+		{"x.1", 0, 0, false},
+	}
+
+	for _, tt := range tests {
+		major, minor, ok := parseKernelVersion(tt.release)
+		if major != tt.major || minor != tt.minor || ok != tt.ok {
+			t.Errorf("%s: got %d.%d %v", tt.release, major, minor, ok)
+		}
+	}
+}
@@ -35,6 +35,7 @@ const (
 	AUDIT_DAEMON_END    uint16 = 1201 /* Daemon normal stop record */
 	AUDIT_DAEMON_ABORT  uint16 = 1202 /* Daemon error stop record */
 	AUDIT_DAEMON_CONFIG uint16 = 1203 /* Daemon config change */
+	AUDIT_DAEMON_ERR    uint16 = 1209 /* Daemon internal error */
 
 	AUDIT_SYSCALL uint16 = 1300 /* Syscall event */
 	/* AUDIT_FS_WATCHuint16 =      1301     * Deprecated */
@@ -92,6 +93,16 @@ const (
 	AUDIT_MAC_CALIPSO_ADD   uint16 = 1418 /* NetLabel: add CALIPSO DOI entry */
 	AUDIT_MAC_CALIPSO_DEL   uint16 = 1419 /* NetLabel: del CALIPSO DOI entry */
 
+	AUDIT_FIRST_APPARMOR   uint16 = 1500
+	AUDIT_LAST_APPARMOR    uint16 = 1599
+	AUDIT_APPARMOR_AUDIT   uint16 = 1501 /* AppArmor audited grants */
+	AUDIT_APPARMOR_ALLOWED uint16 = 1502 /* Allowed Access for learning */
+	AUDIT_APPARMOR_DENIED  uint16 = 1503 /* AppArmor denied access */
+	AUDIT_APPARMOR_HINT    uint16 = 1504 /* Process Tracking information */
+	AUDIT_APPARMOR_STATUS  uint16 = 1505 /* Changes in config */
+	AUDIT_APPARMOR_ERROR   uint16 = 1506 /* Internal AppArmor Errors */
+	AUDIT_APPARMOR_KILL    uint16 = 1507 /* AppArmor killing processes */
+
 	AUDIT_FIRST_KERN_ANOM_MSG   uint16 = 1700
 	AUDIT_LAST_KERN_ANOM_MSG    uint16 = 1799
 	AUDIT_ANOM_PROMISCUOUS      uint16 = 1700 /* Device changed promiscuous mode */
@@ -6,6 +6,7 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 )
 
 type AuditEventType string
@@ -14,17 +15,67 @@ var (
 	ProcessEvent AuditEventType = "process_event"
 	FIMEvent     AuditEventType = "fim_event"
 	UserEvent    AuditEventType = "user_event"
+	SocketEvent  AuditEventType = "socket_event"
+
+	PrivilegeEvent AuditEventType = "privilege_event"
+	KernelEvent    AuditEventType = "kernel_event"
+	MacEvent       AuditEventType = "mac_event"
+	SeccompEvent   AuditEventType = "seccomp_event"
+	AnomalyEvent   AuditEventType = "anomaly_event"
+	IntegrityEvent AuditEventType = "integrity_event"
+	ConfigEvent    AuditEventType = "config_event"
+	TargetEvent    AuditEventType = "target_event"
+	IPCEvent       AuditEventType = "ipc_event"
 )
 
 // eventParsers is a map that holds functions that contains parser for different
 // audit message types which take in a parsed audit message token map and
 // populates the Audit context passed to it.
 var eventParsers = map[uint16]func(*auditContext, AuditMessageTokenMap){
-	1101: parseUserAcctEvent,
+	1107: parseAvcEvent,
+	1200: parseDaemonRecord,
+	1201: parseDaemonRecord,
+	1202: parseDaemonRecord,
+	1203: parseDaemonRecord,
+	1204: parseDaemonRecord,
+	1205: parseDaemonRecord,
+	1206: parseDaemonRecord,
+	1207: parseDaemonRecord,
+	1208: parseDaemonRecord,
+	1209: parseDaemonRecord,
 	1300: parseSyscallEvent,
 	1302: parsePathEvent,
+	1303: parseIpcRecord,
+	1305: parseConfigRecord,
+	1306: parseSockaddrEvent,
 	1307: parseCwdEvent,
+	1309: parseExecveEvent,
+	1311: parseIpcRecord,
+	1312: parseMqRecord,
+	1313: parseMqRecord,
+	1314: parseMqRecord,
+	1315: parseMqRecord,
+	1318: parseObjPidRecord,
+	1321: parseBprmFcapsEvent,
+	1322: parseCapsetEvent,
+	1326: parseSeccompRecord,
 	1327: parseProctitleEvent,
+	1328: parseConfigRecord,
+	1330: parseKernModuleEvent,
+	1334: parseBpfEvent,
+	1400: parseAvcEvent,
+	1700: parseAnomalyRecord,
+	1701: parseAnomalyRecord,
+	1702: parseAnomalyRecord,
+	1703: parseAnomalyRecord,
+	1800: parseIntegrityRecord,
+	1801: parseIntegrityRecord,
+	1802: parseIntegrityRecord,
+	1803: parseIntegrityRecord,
+	1804: parseIntegrityRecord,
+	1805: parseIntegrityRecord,
+	1806: parseIntegrityRecord,
+	1807: parseIntegrityRecord,
 }
 
 // The auditContext keeps track of a single audit event id and all the
@@ -50,21 +101,62 @@ type auditContext struct {
 	ppid       int
 	ses        int
 	exit       int
+	args       [4]string
 
 	// Proctitle record
 	proctitle string
 
+	// Execve records
+	execve *execveArgs
+
 	// Fields from the audit path record
 	cwd       string
 	path      string
 	dest_path string
 	pathItems [5]string
 
+	// Sockaddr record
+	sockaddr *Sockaddr
+
+	// Capset and bprm_fcaps records
+	capabilities *CapabilityChange
+
+	// SELinux or AppArmor access decision
+	mac *AvcRecord
+
+	// Seccomp record
+	seccomp *SeccompRecord
+
+	// Config_change, feature_change or daemon record
+	config *ConfigChangeRecord
+
+	// Anomaly and integrity records
+	anomaly   *AnomalyRecord
+	integrity *IntegrityRecord
+
+	// Obj_pid records
+	targets []ProcessTarget
+
+	// Ipc, ipc_set_perm and mq_* records
+	ipc    *IPCObject
+	mqueue *Mqueue
+
+	// Kern_module and bpf records
+	module    string
+	bpfProgID int
+	bpfOp     string
+
 	// User event fields
+	msgType  uint16
 	msg      string
 	hostname string
 	terminal string
 	res      string
+	op       string
+	acct     string
+	addr     string
+	cmd      string
+	grantors []string
 
 	// Event type which shall be inferred from the events it contains
 	eventType string
@@ -76,30 +168,62 @@ func newAuditContext() *auditContext {
 	return ctx
 }
 
+// The AppArmor records are parsed over the whole range IsMacEvent accepts
+func init() {
+	for t := AUDIT_FIRST_APPARMOR; t <= AUDIT_LAST_APPARMOR; t++ {
+		eventParsers[t] = parseAvcEvent
+	}
+}
+
 // ParseAuditEvent is a audit message parser that reads all the events for an
-// audit event id and returns 2 types of AuditEvents, "process_event" and
-// "fim_event" depending on what syscalls they were emitted for. If the list of
-// audit events don't qualify for either of them, a nil event and false is
-// returned which must be checked to identify a failed parsing.
+// audit event id and returns an AuditEvent, "process_event", "fim_event",
+// "mac_event" and so on depending on the records and the syscall it contains.
+// If the list of audit events don't qualify for any of them, a nil event and
+// false is returned which must be checked to identify a failed parsing.
+//
+// The AVC records must be tokenized with the permissions and the user records
+// with their nested msg, as done by ParseAuditMessageGroup.
 func ParseAuditEvent(tokenList []AuditMessageTokenMap) (*AuditEvent, bool) {
 	ctx := newAuditContext()
 
 	// Potentially a UserEvent. Need to find a better way to classify an event
-	// group.
-	if len(tokenList) == 1 {
+	// group. A syscall may come without any other record.
+	if len(tokenList) == 1 && tokenList[0].AuditEventType != AUDIT_SYSCALL {
 		v := tokenList[0]
-		if v.AuditEventType == 1305 {
-			return nil, false
-		}
-
 		if parser, ok := eventParsers[v.AuditEventType]; ok {
 			parser(ctx, v)
 		}
 
+		if ctx.config != nil {
+			return parseConfigEvent(ctx)
+		}
+
+		if ctx.mac != nil {
+			return parseMacEvent(ctx)
+		}
+
+		if v.AuditEventType == AUDIT_SECCOMP {
+			return parseSeccompEvent(ctx)
+		}
+
+		if ctx.anomaly != nil {
+			return parseAnomalyEvent(ctx)
+		}
+
+		if ctx.integrity != nil {
+			return parseIntegrityEvent(ctx)
+		}
+
 		if IsUserEvent(v.AuditEventType) {
+			parseUserMsgEvent(ctx, v)
 			return parseUserEvent(ctx)
 		}
 
+		// A BPF program is unloaded by the kernel outside of any syscall
+		if v.AuditEventType == AUDIT_BPF {
+			return parseKernelEvent(ctx)
+		}
+
 		return nil, false
 	}
 
@@ -109,20 +233,132 @@ func ParseAuditEvent(tokenList []AuditMessageTokenMap) (*AuditEvent, bool) {
 		}
 	}
 
-	if IsExecSyscall(ctx.syscall) {
-		return parseProcessEvent(ctx)
+	// The audit configuration changes matter more than the syscall they were
+	// made by.
+	if ctx.config != nil {
+		return parseConfigEvent(ctx)
+	}
+
+	// An exec or a file access stays a process or FIM event, an access
+	// decision, a measurement or an anomaly logged along, in permissive mode
+	// or by an IMA audit policy for example, is attached to it.
+	if IsExecSyscall(ctx.syscall) || IsFIMSyscall(ctx.syscall) {
+		return parseSyscallEventWithRecords(ctx)
+	}
+
+	if ctx.mac != nil {
+		return parseMacEvent(ctx)
+	}
+	if ctx.seccomp != nil {
+		return parseSeccompEvent(ctx)
+	}
+	if ctx.anomaly != nil {
+		return parseAnomalyEvent(ctx)
 	}
-	if IsFIMSyscall(ctx.syscall) {
-		return parseFIMEvent(ctx)
+	if ctx.integrity != nil {
+		return parseIntegrityEvent(ctx)
+	}
+	if IsPrivilegeSyscall(ctx.syscall) {
+		return parsePrivilegeEvent(ctx)
+	}
+	if IsKernelSyscall(ctx.syscall) || isBpfProgLoad(ctx) {
+		return parseKernelEvent(ctx)
+	}
+	if IsTargetSyscall(ctx.syscall) {
+		return parseTargetEvent(ctx)
+	}
+	if ctx.ipc != nil || ctx.mqueue != nil {
+		return parseIPCEvent(ctx)
+	}
+	if IsSocketSyscall(ctx.syscall) {
+		return parseSocketEvent(ctx)
 	}
 
 	return nil, false
 }
 
-// Create a process Event from an audit context once it's detected as a process
-// event.
-func parseProcessEvent(auditCtx *auditContext) (*AuditEvent, bool) {
-	ae := &AuditEvent{
+// Creates the process or FIM Event of an exec or file syscall, with the
+// access decision, integrity measurement and anomaly of the group if any.
+func parseSyscallEventWithRecords(auditCtx *auditContext) (*AuditEvent, bool) {
+	parse := parseFIMEvent
+	if IsExecSyscall(auditCtx.syscall) {
+		parse = parseProcessEvent
+	}
+
+	ae, ok := parse(auditCtx)
+	if !ok {
+		return nil, false
+	}
+
+	if mac := auditCtx.mac; mac != nil {
+		ae.Res = mac.Result
+		ae.Permissions = mac.Permissions
+		ae.SourceContext = mac.SourceContext
+		ae.TargetContext = mac.TargetContext
+		ae.Class = mac.Class
+		ae.Permissive = mac.Permissive
+		ae.Profile = mac.Profile
+		ae.Operation = mac.Operation
+	}
+
+	if r := auditCtx.integrity; r != nil {
+		ae.Type = RecordTypeName(r.Type)
+		ae.Cause = r.Cause
+		ae.Hash = r.Hash
+		if ae.Operation == "" {
+			ae.Operation = r.Op
+		}
+		if ae.Res == "" {
+			ae.Res = r.str("res")
+		}
+	}
+
+	if r := auditCtx.anomaly; r != nil {
+		ae.Type = RecordTypeName(r.Type)
+		ae.Signal = r.Sig
+		if ae.Operation == "" {
+			ae.Operation = r.Op
+		}
+	}
+
+	return ae, true
+}
+
+// ParseAuditMessageGroup tokenizes the messages of a group and parses them with
+// ParseAuditEvent. The event gets the time and sequence id of the group as its
+// timestamp and event id, and the containers of its messages.
+func ParseAuditMessageGroup(msg *AuditMessageGroup) (*AuditEvent, bool) {
+	tokenList := make([]AuditMessageTokenMap, 0, len(msg.Msgs))
+	for _, d := range msg.Msgs {
+		tokenList = append(tokenList, AuditMessageTokenMap{
+			AuditEventType: d.Type,
+			Tokens:         tokenizeRecord(d.Type, d.Data),
+		})
+	}
+
+	ev, ok := ParseAuditEvent(tokenList)
+	if !ok {
+		return nil, false
+	}
+
+	ev.Timestamp = msg.Timestamp
+	ev.EventID = msg.Seq
+
+	// Set by the containers extra parsers
+	for _, d := range msg.Msgs {
+		if d.Containers != nil {
+			ev.Containers = d.Containers
+			break
+		}
+	}
+
+	return ev, true
+}
+
+// newSyscallEvent creates an event with the syscall and the identity of the
+// process which made it.
+func newSyscallEvent(auditCtx *auditContext, name AuditEventType) *AuditEvent {
+	return &AuditEvent{
 		Arch:        auditCtx.arch,
 		Syscall:     SyscallName(auditCtx.syscall),
 		Success:     auditCtx.success,
@@ -145,7 +381,36 @@ func parseProcessEvent(auditCtx *auditContext) (*AuditEvent, bool) {
 		Commandline: auditCtx.proctitle,
 		Cwd:         auditCtx.cwd,
 		Key:         auditCtx.key,
-		Name:        ProcessEvent,
+		Name:        name,
+	}
+}
+
+// Create a process Event from an audit context once it's detected as a process
+// event.
+func parseProcessEvent(auditCtx *auditContext) (*AuditEvent, bool) {
+	ae := newSyscallEvent(auditCtx, ProcessEvent)
+
+	// The proctitle is truncated by the kernel, it's only used without the
+	// execve records.
+	if auditCtx.execve != nil {
+		ae.Argv = auditCtx.execve.argv()
+		ae.Commandline = strings.Join(ae.Argv, " ")
+	}
+
+	// A setuid or setgid program, or one with file capabilities, is a
+	// privilege change. The effective ids it got are the new ones, the real
+	// ids it kept the old ones.
+	if auditCtx.capabilities == nil && auditCtx.euid == auditCtx.uid && auditCtx.egid == auditCtx.gid {
+		return ae, true
+	}
+
+	ae.Name = PrivilegeEvent
+	ae.Capabilities = auditCtx.capabilities
+	if auditCtx.euid != auditCtx.uid {
+		ae.setIDs("euid", auditCtx.uid, auditCtx.euid)
+	}
+	if auditCtx.egid != auditCtx.gid {
+		ae.setIDs("egid", auditCtx.gid, auditCtx.egid)
 	}
 
 	return ae, true
@@ -158,31 +423,7 @@ func parseFIMEvent(auditCtx *auditContext) (*AuditEvent, bool) {
 	// to their absolute paths for processing.
 	resolvePath(auditCtx)
 
-	ae := &AuditEvent{
-		Arch:        auditCtx.arch,
-		Syscall:     SyscallName(auditCtx.syscall),
-		Success:     auditCtx.success,
-		Exit:        auditCtx.exit,
-		Ppid:        auditCtx.ppid,
-		Pid:         auditCtx.pid,
-		Auid:        auditCtx.auid,
-		Uid:         auditCtx.uid,
-		Gid:         auditCtx.gid,
-		Euid:        auditCtx.euid,
-		Suid:        auditCtx.suid,
-		Fsuid:       auditCtx.fsuid,
-		Egid:        auditCtx.egid,
-		Sgid:        auditCtx.sgid,
-		Fsgid:       auditCtx.fsgid,
-		Tty:         auditCtx.tty,
-		Session:     auditCtx.ses,
-		Comm:        auditCtx.comm,
-		Exectuable:  auditCtx.executable,
-		Commandline: auditCtx.proctitle,
-		Cwd:         auditCtx.cwd,
-		Key:         auditCtx.key,
-		Name:        FIMEvent,
-	}
+	ae := newSyscallEvent(auditCtx, FIMEvent)
 
 	// Additional steps in case the syscall is of the rename family
 	ae.Path = auditCtx.path
@@ -191,6 +432,347 @@ func parseFIMEvent(auditCtx *auditContext) (*AuditEvent, bool) {
 	return ae, true
 }
 
+// Creates a socket Event from an audit context once it's detected as a socket
+// event. The address is the local one for bind, the remote one otherwise.
+func parseSocketEvent(auditCtx *auditContext) (*AuditEvent, bool) {
+	ae := newSyscallEvent(auditCtx, SocketEvent)
+
+	sa := auditCtx.sockaddr
+	if sa == nil {
+		return ae, true
+	}
+
+	ae.Family = sa.Family
+	ae.Socket = sa.Path
+	if ae.Syscall == "bind" {
+		ae.LocalAddress, ae.LocalPort = sa.Address, sa.Port
+	} else {
+		ae.RemoteAddress, ae.RemotePort = sa.Address, sa.Port
+	}
+
+	return ae, true
+}
+
+// Creates a privilege Event from an audit context once it's detected as a
+// privilege change. NewIDs are the ids passed to a set*id syscall, without the
+// ones left unchanged, and OldIDs the ones of the SYSCALL record.
+func parsePrivilegeEvent(auditCtx *auditContext) (*AuditEvent, bool) {
+	ae := newSyscallEvent(auditCtx, PrivilegeEvent)
+	ae.Capabilities = auditCtx.capabilities
+
+	ids := map[string]int{
+		"uid": ae.Uid, "euid": ae.Euid, "suid": ae.Suid, "fsuid": ae.Fsuid,
+		"gid": ae.Gid, "egid": ae.Egid, "sgid": ae.Sgid, "fsgid": ae.Fsgid,
+	}
+
+	for i, name := range setIDArgs[strings.TrimSuffix(ae.Syscall, "32")] {
+		id, err := strconv.ParseUint(auditCtx.args[i], 16, 64)
+		if err != nil || uint32(id) == ^uint32(0) {
+			continue
+		}
+
+		ae.setIDs(name, ids[name], int(uint32(id)))
+	}
+
+	return ae, true
+}
+
+// setIDs records the old and new value of an id changed by a privilege event
+func (ae *AuditEvent) setIDs(name string, old, new int) {
+	if ae.NewIDs == nil {
+		ae.OldIDs, ae.NewIDs = make(map[string]int), make(map[string]int)
+	}
+	ae.OldIDs[name], ae.NewIDs[name] = old, new
+}
+
+// Creates a kernel Event from an audit context once it's detected as a kernel
+// module or BPF program load or unload. Module is the name of the module, or
+// the path of the file loaded by finit_module when the name isn't logged.
+func parseKernelEvent(auditCtx *auditContext) (*AuditEvent, bool) {
+	ae := newSyscallEvent(auditCtx, KernelEvent)
+
+	switch ae.Syscall {
+	case "init_module", "finit_module":
+		ae.Operation = "LOAD"
+	case "delete_module":
+		ae.Operation = "UNLOAD"
+	}
+
+	ae.Module = auditCtx.module
+	if path := strings.Trim(auditCtx.pathItems[0], `"`); ae.Module == "" && path != "" {
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(auditCtx.cwd, path)
+		}
+		ae.Module = path
+	}
+
+	if auditCtx.bpfOp != "" {
+		ae.Operation = auditCtx.bpfOp
+		ae.BpfProgID = auditCtx.bpfProgID
+	} else if ae.Syscall == "bpf" {
+		// The kernels before 5.8 log no BPF record
+		ae.Operation = "LOAD"
+	}
+
+	return ae, true
+}
+
+// bpfProgLoad is BPF_PROG_LOAD, the bpf command loading a program
+const bpfProgLoad = 5
+
+// isBpfProgLoad tells whether an audit context is a bpf syscall loading a
+// program, the other commands only act on the loaded ones and their maps.
+func isBpfProgLoad(ctx *auditContext) bool {
+	if SyscallName(ctx.syscall) != "bpf" {
+		return false
+	}
+
+	cmd, err := strconv.ParseUint(ctx.args[0], 16, 64)
+	return ctx.bpfOp != "" || (err == nil && cmd == bpfProgLoad)
+}
+
+// Creates a target Event from an audit context once it's detected as a ptrace,
+// process_vm_writev or signal syscall. The targets are the ones of the OBJ_PID
+// records, or the pid argument when none was logged. Operation is the ptrace
+// request and Signal the signal sent.
+func parseTargetEvent(auditCtx *auditContext) (*AuditEvent, bool) {
+	ae := newSyscallEvent(auditCtx, TargetEvent)
+	args := targetArgs[ae.Syscall]
+
+	ae.Targets = auditCtx.targets
+	if ae.Targets == nil {
+		pid, err := strconv.ParseUint(auditCtx.args[args[0]], 16, 64)
+		if err == nil && int32(pid) > 0 {
+			ae.Targets = []ProcessTarget{{Pid: int(int32(pid))}}
+		}
+	}
+
+	if ae.Syscall == "ptrace" {
+		req, _ := strconv.ParseUint(auditCtx.args[0], 16, 64)
+		if ae.Operation = ptraceRequests[req]; ae.Operation == "" {
+			ae.Operation = strconv.FormatUint(req, 10)
+		}
+	}
+
+	if args[1] >= 0 {
+		sig, _ := strconv.ParseUint(auditCtx.args[args[1]], 16, 64)
+		ae.Signal = int(sig)
+	}
+
+	return ae, true
+}
+
+// Creates an IPC Event from an audit context holding the SysV IPC object or
+// the POSIX message queue a syscall accessed.
+func parseIPCEvent(auditCtx *auditContext) (*AuditEvent, bool) {
+	ae := newSyscallEvent(auditCtx, IPCEvent)
+	ae.IPC = auditCtx.ipc
+	ae.Mqueue = auditCtx.mqueue
+
+	return ae, true
+}
+
+// Creates a MAC Event from an audit context holding a SELinux or AppArmor
+// access decision. The process is the one of the syscall record if any, of
+// the decision record otherwise.
+func parseMacEvent(auditCtx *auditContext) (*AuditEvent, bool) {
+	ae := newSyscallEvent(auditCtx, MacEvent)
+	mac := auditCtx.mac
+
+	if auditCtx.syscall < 0 {
+		ae.Syscall = ""
+		ae.Pid = mac.Pid
+		ae.Comm = mac.Comm
+	}
+
+	ae.Res = mac.Result
+	ae.Permissions = mac.Permissions
+	ae.SourceContext = mac.SourceContext
+	ae.TargetContext = mac.TargetContext
+	ae.Class = mac.Class
+	ae.Permissive = mac.Permissive
+	ae.Profile = mac.Profile
+	ae.Operation = mac.Operation
+	ae.Path = mac.Name
+
+	return ae, true
+}
+
+// Creates a seccomp Event from the seccomp record of an audit context. The
+// syscall is named unless it's a compat one, from the 32 bit table. The
+// errno of a SECCOMP_RET_ERRNO action is returned in Exit.
+func parseSeccompEvent(auditCtx *auditContext) (*AuditEvent, bool) {
+	r := auditCtx.seccomp
+
+	syscall := SyscallName(r.Syscall)
+	if syscall == "" || r.Compat != 0 {
+		syscall = strconv.Itoa(r.Syscall)
+	}
+
+	ae := &AuditEvent{
+		Arch:       r.Arch,
+		Syscall:    syscall,
+		Pid:        r.Pid,
+		Auid:       r.Auid,
+		Uid:        r.Uid,
+		Gid:        r.Gid,
+		Session:    r.Ses,
+		Comm:       r.Comm,
+		Exectuable: r.Exe,
+		Action:     r.Action(),
+		Signal:     r.Sig,
+		IP:         r.str("ip"),
+		Code:       r.str("code"),
+		Name:       SeccompEvent,
+	}
+
+	if r.Code&SECCOMP_RET_ACTION_FULL == SECCOMP_RET_ERRNO {
+		ae.Exit = -int(r.Code & SECCOMP_RET_DATA)
+	}
+
+	return ae, true
+}
+
+// Creates an anomaly Event from the ANOM_* record of an audit context. The
+// operation of a promiscuous mode change is promiscuous_on or promiscuous_off,
+// the paths of a link or creat anomaly come from the path records.
+func parseAnomalyEvent(auditCtx *auditContext) (*AuditEvent, bool) {
+	r := auditCtx.anomaly
+	resolvePath(auditCtx)
+
+	ae := newSyscallEvent(auditCtx, AnomalyEvent)
+	if auditCtx.syscall < 0 {
+		ae.Pid, ae.Auid, ae.Uid, ae.Gid, ae.Session = r.Pid, r.Auid, r.Uid, r.Gid, r.Ses
+		ae.Comm, ae.Exectuable = r.Comm, r.Exe
+	}
+
+	ae.Type = RecordTypeName(r.Type)
+	ae.Operation = r.Op
+	ae.Signal = r.Sig
+	ae.Res = r.str("res")
+	ae.Path = auditCtx.path
+	if path := auditCtx.pathItems[0]; ae.Path == "" && path != "" {
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(auditCtx.cwd, path)
+		}
+		ae.Path = path
+	}
+
+	if r.Type == AUDIT_ANOM_PROMISCUOUS {
+		ae.Device = r.Dev
+		ae.Operation = "promiscuous_off"
+		if r.Prom != 0 {
+			ae.Operation = "promiscuous_on"
+		}
+	}
+
+	return ae, true
+}
+
+// Creates an integrity Event from the INTEGRITY_* record of an audit context,
+// logged by IMA and EVM for the measurements and appraisal failures.
+func parseIntegrityEvent(auditCtx *auditContext) (*AuditEvent, bool) {
+	r := auditCtx.integrity
+
+	ae := newSyscallEvent(auditCtx, IntegrityEvent)
+	if auditCtx.syscall < 0 {
+		ae.Pid, ae.Auid, ae.Uid, ae.Session = r.Pid, r.Auid, r.Uid, r.Ses
+		ae.Comm = r.Comm
+	}
+
+	ae.Type = RecordTypeName(r.Type)
+	ae.Operation = r.Op
+	ae.Cause = r.Cause
+	ae.Path = r.File
+	ae.Hash = r.Hash
+	ae.Res = r.str("res")
+
+	return ae, true
+}
+
+// Creates a config Event from the CONFIG_CHANGE, FEATURE_CHANGE or DAEMON_*
+// record of an audit context, flagged with Alert when it changes a rule with a
+// protected key.
+func parseConfigEvent(auditCtx *auditContext) (*AuditEvent, bool) {
+	r := auditCtx.config
+
+	ae := newSyscallEvent(auditCtx, ConfigEvent)
+	if auditCtx.syscall < 0 {
+		ae.Pid, ae.Auid, ae.Session = r.Pid, r.Auid, r.Ses
+		ae.Uid, _ = strconv.Atoi(r.str("uid"))
+		ae.Comm = r.untrusted("comm")
+		ae.Exectuable = r.untrusted("exe")
+	}
+
+	ae.Type = RecordTypeName(r.Type)
+	ae.Operation = r.Op
+	ae.Res = r.str("res")
+	ae.Setting = r.Setting
+	ae.Value = r.Value
+	ae.OldValue = r.OldValue
+	if _, ok := r.Fields["list"]; ok {
+		ae.List = filterListNames[r.List]
+	}
+
+	if r.Key != "" && r.Key != "(null)" {
+		ae.Key = r.Key
+		ae.Alert = strings.HasSuffix(r.Op, "_rule") && IsProtectedRuleKey(r.Key)
+	}
+
+	return ae, true
+}
+
+// filterListNames are the names of the rule lists, as auditctl names them
+var filterListNames = map[int]string{
+	int(AUDIT_FILTER_USER):    "user",
+	int(AUDIT_FILTER_TASK):    "task",
+	int(AUDIT_FILTER_ENTRY):   "entry",
+	int(AUDIT_FILTER_WATCH):   "watch",
+	int(AUDIT_FILTER_EXIT):    "exit",
+	int(AUDIT_FILTER_EXCLUDE): "exclude",
+	int(AUDIT_FILTER_FS):      "filesystem",
+}
+
+var (
+	protectedKeys   = map[string]bool{}
+	protectedKeysMu sync.RWMutex
+)
+
+// ProtectRuleKeys marks the rules with one of the keys, usually the rules
+// auditrd loaded, as protected. The config events adding or removing one of
+// them are flagged with Alert.
+func ProtectRuleKeys(keys ...string) {
+	protectedKeysMu.Lock()
+	defer protectedKeysMu.Unlock()
+
+	for _, k := range keys {
+		protectedKeys[k] = true
+	}
+}
+
+// IsProtectedRuleKey tells whether a rule key was protected with
+// ProtectRuleKeys.
+func IsProtectedRuleKey(key string) bool {
+	protectedKeysMu.RLock()
+	defer protectedKeysMu.RUnlock()
+
+	return protectedKeys[key]
+}
+
+// setIDArgs are the ids set by the arguments of the set*id syscalls
+var setIDArgs = map[string][]string{
+	"setuid":    {"uid"},
+	"setreuid":  {"uid", "euid"},
+	"setresuid": {"uid", "euid", "suid"},
+	"setfsuid":  {"fsuid"},
+	"setgid":    {"gid"},
+	"setregid":  {"gid", "egid"},
+	"setresgid": {"gid", "egid", "sgid"},
+	"setfsgid":  {"fsgid"},
+}
+
+// Creates a user Event from the audit context of a user space message, Type
+// tells which one it is.
 func parseUserEvent(auditCtx *auditContext) (*AuditEvent, bool) {
 	return &AuditEvent{
 		Success:    auditCtx.res,
@@ -202,6 +784,16 @@ func parseUserEvent(auditCtx *auditContext) (*AuditEvent, bool) {
 		Exectuable: auditCtx.executable,
 		Key:        auditCtx.key,
 		Name:       UserEvent,
+		Type:       RecordTypeName(auditCtx.msgType),
+		Operation:  auditCtx.op,
+		Acct:       auditCtx.acct,
+		Addr:       auditCtx.addr,
+		Hostname:   auditCtx.hostname,
+		Terminal:   auditCtx.terminal,
+		Res:        auditCtx.res,
+		Grantors:   auditCtx.grantors,
+		Cmd:        auditCtx.cmd,
+		Cwd:        auditCtx.cwd,
 	}, true
 }
 
@@ -290,6 +882,10 @@ func parseSyscallEvent(ctx *auditContext, m AuditMessageTokenMap) {
 
 	ctx.ses, _ = strconv.Atoi(m.Tokens["ses"])
 
+	for i := range ctx.args {
+		ctx.args[i] = m.Tokens["a"+strconv.Itoa(i)]
+	}
+
 	ctx.tty = m.Tokens["tty"]
 	ctx.comm = strings.Trim(m.Tokens["comm"], `"`)
 	ctx.executable = strings.Trim(m.Tokens["exe"], `"`)
@@ -314,6 +910,300 @@ func parsePathEvent(ctx *auditContext, m AuditMessageTokenMap) {
 	ctx.pathItems[item] = m.Tokens["name"]
 }
 
+func parseSockaddrEvent(ctx *auditContext, m AuditMessageTokenMap) {
+	if m.AuditEventType != AUDIT_SOCKADDR {
+		return
+	}
+
+	saddr, err := hex.DecodeString(m.Tokens["saddr"])
+	if err != nil {
+		return
+	}
+	ctx.sockaddr, _ = ParseSockaddr(saddr)
+}
+
+func parseCapsetEvent(ctx *auditContext, m AuditMessageTokenMap) {
+	if m.AuditEventType != AUDIT_CAPSET {
+		return
+	}
+
+	r := decodeCapset(RecordFields{Type: m.AuditEventType, Fields: m.Tokens}).(*CapsetRecord)
+	ctx.capabilities = &CapabilityChange{
+		Permitted:   r.Permitted.Names(),
+		Inheritable: r.Inheritable.Names(),
+		Effective:   r.Effective.Names(),
+		Ambient:     r.Ambient.Names(),
+	}
+}
+
+func parseBprmFcapsEvent(ctx *auditContext, m AuditMessageTokenMap) {
+	if m.AuditEventType != AUDIT_BPRM_FCAPS {
+		return
+	}
+
+	r := decodeBprmFcaps(RecordFields{Type: m.AuditEventType, Fields: m.Tokens}).(*BprmFcapsRecord)
+	ctx.capabilities = &CapabilityChange{
+		Permitted:       r.Permitted.Names(),
+		Inheritable:     r.Inheritable.Names(),
+		Effective:       r.Effective.Names(),
+		Ambient:         r.Ambient.Names(),
+		OldPermitted:    r.OldPermitted.Names(),
+		OldInheritable:  r.OldInheritable.Names(),
+		OldEffective:    r.OldEffective.Names(),
+		OldAmbient:      r.OldAmbient.Names(),
+		FilePermitted:   r.FilePermitted.Names(),
+		FileInheritable: r.FileInheritable.Names(),
+	}
+}
+
+// parseAvcEvent parses the SELinux and AppArmor access decisions. The one of
+// a USER_AVC, from a user space object manager like dbus, is its nested msg.
+func parseAvcEvent(ctx *auditContext, m AuditMessageTokenMap) {
+	if !IsMacEvent(m.AuditEventType) {
+		return
+	}
+
+	fields := m.Tokens
+	if m.AuditEventType == AUDIT_USER_AVC {
+		msg := strings.Trim(m.Tokens["msg"], "'")
+		fields = tokenizeAvc(msg)
+
+		ctx.pid, _ = strconv.Atoi(m.Tokens["pid"])
+		ctx.uid, _ = strconv.Atoi(m.Tokens["uid"])
+		ctx.auid, _ = strconv.Atoi(m.Tokens["auid"])
+		ctx.ses, _ = strconv.Atoi(m.Tokens["ses"])
+		ctx.executable = decodeUntrusted(fields["exe"])
+	}
+
+	ctx.mac = decodeAvc(RecordFields{Type: m.AuditEventType, Fields: fields}).(*AvcRecord)
+	if m.AuditEventType == AUDIT_USER_AVC && ctx.mac.Pid == 0 {
+		ctx.mac.Pid = ctx.pid
+	}
+}
+
+func parseSeccompRecord(ctx *auditContext, m AuditMessageTokenMap) {
+	if m.AuditEventType != AUDIT_SECCOMP {
+		return
+	}
+
+	ctx.seccomp = decodeSeccomp(RecordFields{Type: m.AuditEventType, Fields: m.Tokens}).(*SeccompRecord)
+}
+
+func parseAnomalyRecord(ctx *auditContext, m AuditMessageTokenMap) {
+	if m.AuditEventType < AUDIT_FIRST_KERN_ANOM_MSG || m.AuditEventType > AUDIT_LAST_KERN_ANOM_MSG {
+		return
+	}
+
+	ctx.anomaly = decodeAnomaly(RecordFields{Type: m.AuditEventType, Fields: m.Tokens}).(*AnomalyRecord)
+}
+
+func parseIntegrityRecord(ctx *auditContext, m AuditMessageTokenMap) {
+	if m.AuditEventType < AUDIT_INTEGRITY_DATA || m.AuditEventType > AUDIT_INTEGRITY_POLICY_RULE {
+		return
+	}
+
+	ctx.integrity = decodeIntegrity(RecordFields{Type: m.AuditEventType, Fields: m.Tokens}).(*IntegrityRecord)
+}
+
+func parseConfigRecord(ctx *auditContext, m AuditMessageTokenMap) {
+	if m.AuditEventType != AUDIT_CONFIG_CHANGE && m.AuditEventType != AUDIT_FEATURE_CHANGE {
+		return
+	}
+
+	ctx.config = decodeConfigChange(RecordFields{Type: m.AuditEventType, Fields: m.Tokens}).(*ConfigChangeRecord)
+}
+
+// parseDaemonRecord parses the records auditd logs about itself, like
+//
+//	op=start ver=3.0 format=enriched kernel=5.10.0 auid=4294967295 pid=1 uid=0 ses=4294967295 res=success
+func parseDaemonRecord(ctx *auditContext, m AuditMessageTokenMap) {
+	if m.AuditEventType < AUDIT_DAEMON_START || m.AuditEventType > AUDIT_DAEMON_ERR {
+		return
+	}
+
+	r := RecordFields{Type: m.AuditEventType, Fields: m.Tokens}
+	ctx.config = &ConfigChangeRecord{
+		RecordFields: r,
+		Op:           r.str("op"),
+		Pid:          r.int("pid"),
+		Auid:         r.int("auid"),
+		Ses:          r.int("ses"),
+	}
+}
+
+func parseObjPidRecord(ctx *auditContext, m AuditMessageTokenMap) {
+	if m.AuditEventType != AUDIT_OBJ_PID {
+		return
+	}
+
+	r := decodeObjPid(RecordFields{Type: m.AuditEventType, Fields: m.Tokens}).(*ObjPidRecord)
+	ctx.targets = append(ctx.targets, ProcessTarget{
+		Pid:     r.Pid,
+		Auid:    r.Auid,
+		Uid:     r.Uid,
+		Session: r.Ses,
+		Comm:    r.Comm,
+		Context: r.Context,
+	})
+}
+
+// parseIpcRecord parses the IPC record of the object accessed and the
+// IPC_SET_PERM record of the owner and mode set, in any order.
+func parseIpcRecord(ctx *auditContext, m AuditMessageTokenMap) {
+	if m.AuditEventType != AUDIT_IPC && m.AuditEventType != AUDIT_IPC_SET_PERM {
+		return
+	}
+
+	r := decodeIpc(RecordFields{Type: m.AuditEventType, Fields: m.Tokens}).(*IpcRecord)
+	if ctx.ipc == nil {
+		ctx.ipc = new(IPCObject)
+	}
+
+	if m.AuditEventType == AUDIT_IPC_SET_PERM {
+		ctx.ipc.NewOuid, ctx.ipc.NewOgid = &r.Ouid, &r.Ogid
+		ctx.ipc.NewMode = r.str("mode")
+		ctx.ipc.QBytes = r.QBytes
+		return
+	}
+
+	ctx.ipc.Ouid, ctx.ipc.Ogid = r.Ouid, r.Ogid
+	ctx.ipc.Mode = r.str("mode")
+	ctx.ipc.Context = r.Context
+}
+
+func parseMqRecord(ctx *auditContext, m AuditMessageTokenMap) {
+	if m.AuditEventType < AUDIT_MQ_OPEN || m.AuditEventType > AUDIT_MQ_GETSETATTR {
+		return
+	}
+
+	ctx.mqueue = newMqueue(recordDecoders[m.AuditEventType](RecordFields{Type: m.AuditEventType, Fields: m.Tokens}))
+}
+
+func parseKernModuleEvent(ctx *auditContext, m AuditMessageTokenMap) {
+	if m.AuditEventType != AUDIT_KERN_MODULE {
+		return
+	}
+
+	ctx.module = decodeUntrusted(m.Tokens["name"])
+}
+
+func parseBpfEvent(ctx *auditContext, m AuditMessageTokenMap) {
+	if m.AuditEventType != AUDIT_BPF {
+		return
+	}
+
+	ctx.bpfProgID, _ = strconv.Atoi(m.Tokens["prog-id"])
+	ctx.bpfOp = m.Tokens["op"]
+}
+
+func parseExecveEvent(ctx *auditContext, m AuditMessageTokenMap) {
+	if m.AuditEventType != AUDIT_EXECVE {
+		return
+	}
+
+	if ctx.execve == nil {
+		ctx.execve = newExecveArgs()
+	}
+	ctx.execve.add(m.Tokens)
+}
+
+// execveArgs rebuilds argv from the execve records. The arguments are logged
+// as aN, quoted or hex encoded, and an argument too long for a record is split
+// in aN[i] chunks which may span several records, after an aN_len field.
+type execveArgs struct {
+	argc   int
+	args   map[int]string
+	chunks map[int]map[int]string
+}
+
+// MAX_EXECVE_ARGS bounds the argument indexes accepted from the execve records,
+// which may come from a log file or stdin rather than the kernel.
+const MAX_EXECVE_ARGS = 1 << 20
+
+func newExecveArgs() *execveArgs {
+	return &execveArgs{
+		args:   make(map[int]string),
+		chunks: make(map[int]map[int]string),
+	}
+}
+
+func (e *execveArgs) add(tokens map[string]string) {
+	for k, v := range tokens {
+		if k == "argc" {
+			e.argc, _ = strconv.Atoi(v)
+			continue
+		}
+
+		if len(k) < 2 || k[0] != 'a' || strings.HasSuffix(k, "_len") {
+			continue
+		}
+
+		// aN or aN[i]
+		name, chunk := k[1:], ""
+		if open := strings.IndexByte(name, '['); open >= 0 && strings.HasSuffix(name, "]") {
+			name, chunk = name[:open], name[open+1:len(name)-1]
+		}
+
+		n, err := strconv.Atoi(name)
+		if err != nil || n < 0 || n >= MAX_EXECVE_ARGS {
+			continue
+		}
+
+		if chunk == "" {
+			e.args[n] = decodeUntrusted(v)
+			continue
+		}
+
+		i, err := strconv.Atoi(chunk)
+		if err != nil {
+			continue
+		}
+		if e.chunks[n] == nil {
+			e.chunks[n] = make(map[int]string)
+		}
+		e.chunks[n][i] = decodeUntrusted(v)
+	}
+}
+
+// argv returns the arguments, the missing ones are empty. The argc of the
+// first record is only trusted up to the last argument seen, a negative or
+// missing argc means all the arguments seen.
+func (e *execveArgs) argv() []string {
+	seen := 0
+	for n := range e.args {
+		if n >= seen {
+			seen = n + 1
+		}
+	}
+	for n := range e.chunks {
+		if n >= seen {
+			seen = n + 1
+		}
+	}
+
+	argc := e.argc
+	if argc <= 0 || argc > seen {
+		argc = seen
+	}
+
+	argv := make([]string, argc)
+	for n := range argv {
+		if arg, ok := e.args[n]; ok {
+			argv[n] = arg
+			continue
+		}
+
+		chunks := e.chunks[n]
+		var b strings.Builder
+		for i := 0; i < len(chunks); i++ {
+			b.WriteString(chunks[i])
+		}
+		argv[n] = b.String()
+	}
+
+	return argv
+}
+
 func parseProctitleEvent(ctx *auditContext, m AuditMessageTokenMap) {
 	if m.AuditEventType != 1327 {
 		return
@@ -329,20 +1219,48 @@ func parseProctitleEvent(ctx *auditContext, m AuditMessageTokenMap) {
 	ctx.proctitle = string(bytes.ReplaceAll(args, []byte{0}, []byte{' '}))
 }
 
-func parseUserAcctEvent(ctx *auditContext, m AuditMessageTokenMap) {
-	// pid=16192 uid=1000 auid=1000 ses=1 msg='op=PAM:accounting grantors=pam_permit acct="p0n002h" exe="/usr/bin/sudo" hostname=? addr=? terminal=/dev/pts/2 res=success'
-	if m.AuditEventType != AUDIT_USER_ACCT {
+// parseUserMsgEvent parses a user space message like
+//
+//	pid=16192 uid=1000 auid=1000 ses=1 msg='op=PAM:accounting grantors=pam_permit acct="p0n002h" exe="/usr/bin/sudo" hostname=? addr=? terminal=/dev/pts/2 res=success'
+//
+// The fields of the msg are tokenized in turn, they are looked up there first.
+func parseUserMsgEvent(ctx *auditContext, m AuditMessageTokenMap) {
+	if !IsUserEvent(m.AuditEventType) {
 		return
 	}
 
-	ctx.msg = m.Tokens["msg"]
+	msg := m.Tokens["msg"]
+	nested := map[string]string{}
+	if len(msg) >= 2 && msg[0] == '\'' && msg[len(msg)-1] == '\'' {
+		msg = msg[1 : len(msg)-1]
+		nested = tokenizeUserRecord(msg)
+	}
+
+	field := func(name string) string {
+		if v, ok := nested[name]; ok {
+			return v
+		}
+		return m.Tokens[name]
+	}
+
+	ctx.msgType = m.AuditEventType
+	ctx.msg = msg
 	ctx.ses, _ = strconv.Atoi(m.Tokens["ses"])
 	ctx.pid, _ = strconv.Atoi(m.Tokens["pid"])
 	ctx.uid, _ = strconv.Atoi(m.Tokens["uid"])
 	ctx.auid, _ = strconv.Atoi(m.Tokens["auid"])
-	ctx.executable = strings.Trim(m.Tokens["exe"], `"`)
-	ctx.hostname = m.Tokens["hostname"]
-	ctx.terminal = m.Tokens["terminal"]
-	ctx.res = m.Tokens["res"]
-	ctx.key = m.Tokens["key"]
+	ctx.executable = decodeUntrusted(field("exe"))
+	ctx.hostname = field("hostname")
+	ctx.terminal = field("terminal")
+	ctx.res = field("res")
+	ctx.key = field("key")
+
+	ctx.op = field("op")
+	ctx.acct = decodeUntrusted(field("acct"))
+	ctx.addr = field("addr")
+	ctx.cmd = decodeUntrusted(field("cmd"))
+	ctx.cwd = decodeUntrusted(field("cwd"))
+	if grantors := field("grantors"); grantors != "" && grantors != "?" {
+		ctx.grantors = strings.Split(grantors, ",")
+	}
 }
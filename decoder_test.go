@@ -0,0 +1,612 @@
+package auditrd
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestExecveArgs(t *testing.T) {
+	records := []string{
+		`argc=4 a0="cat" a1=2F746D702F6120622063 a2_len=24 a2[0]=68656C6C6F20`,
+		`a2[1]=776F726C6421 a3="-"`,
+	}
+
+	args := newExecveArgs()
+	for _, r := range records {
+		args.add(Tokenize(r))
+	}
+
+	want := []string{"cat", "/tmp/a b c", "hello world!", "-"}
+	if argv := args.argv(); !reflect.DeepEqual(argv, want) {
+		t.Errorf("Expected %q, got %q", want, argv)
+	}
+
+	// Without argc the arguments seen are used
+	args = newExecveArgs()
+	args.add(Tokenize(`a0="ls" a1="-l"`))
+	if argv := args.argv(); !reflect.DeepEqual(argv, []string{"ls", "-l"}) {
+		t.Errorf("Unexpected argv %q", argv)
+	}
+
+	// A bogus argc or index from a log file doesn't size argv
+	for _, r := range []string{`argc=-1 a0="ls"`, `argc=2000000000 a0="ls"`, `argc=1 a0="ls" a99999999="x"`} {
+		args = newExecveArgs()
+		args.add(Tokenize(r))
+		if argv := args.argv(); !reflect.DeepEqual(argv, []string{"ls"}) {
+			t.Errorf("%s: unexpected argv %q", r, argv)
+		}
+	}
+}
+
+func TestParseProcessEventArgv(t *testing.T) {
+	ctx := newAuditContext()
+	parseProctitleEvent(ctx, AuditMessageTokenMap{AuditEventType: AUDIT_PROCTITLE,
+		Tokens: Tokenize(`proctitle=6C73002D6C`)})
+
+	ev, _ := parseProcessEvent(ctx)
+	if ev.Commandline != "ls -l" || ev.Argv != nil {
+		t.Errorf("Expected the proctitle without execve, got %q %q", ev.Commandline, ev.Argv)
+	}
+
+	parseExecveEvent(ctx, AuditMessageTokenMap{AuditEventType: AUDIT_EXECVE,
+		Tokens: Tokenize(`argc=3 a0="ls" a1="-l" a2=2F612076657279206C6F6E672070617468`)})
+
+	ev, _ = parseProcessEvent(ctx)
+	if ev.Commandline != "ls -l /a very long path" || len(ev.Argv) != 3 {
+		t.Errorf("Expected the execve arguments, got %q %q", ev.Commandline, ev.Argv)
+	}
+}
+
+func TestParseSocketEvent(t *testing.T) {
+	syscallNumberToName[42], syscallNumberToName[49] = "connect", "bind"
+	defer delete(syscallNumberToName, 42)
+	defer delete(syscallNumberToName, 49)
+
+	tests := []struct {
+		syscall string
+		local   string
+		remote  string
+	}{
+		{"42", "", "10.0.0.1:8080"},
+		{"49", "10.0.0.1:8080", ""},
+	}
+
+	for _, test := range tests {
+		ev, ok := ParseAuditEvent([]AuditMessageTokenMap{
+			{AuditEventType: AUDIT_SYSCALL, Tokens: Tokenize(
+				`arch=c000003e syscall=` + test.syscall + ` success=yes exit=0 pid=7 uid=0 comm="curl" exe="/usr/bin/curl"`)},
+			{AuditEventType: AUDIT_SOCKADDR, Tokens: Tokenize(`saddr=02001F900A0000010000000000000000`)},
+		})
+		if !ok || ev.Name != SocketEvent {
+			t.Fatalf("%s: expected a socket event, got %+v", test.syscall, ev)
+		}
+
+		local := ev.LocalAddress
+		if local != "" {
+			local += ":" + strconv.Itoa(ev.LocalPort)
+		}
+		remote := ev.RemoteAddress
+		if remote != "" {
+			remote += ":" + strconv.Itoa(ev.RemotePort)
+		}
+
+		if ev.Family != "inet" || local != test.local || remote != test.remote || ev.Pid != 7 {
+			t.Errorf("%s: unexpected event %+v", test.syscall, ev)
+		}
+	}
+}
+
+func TestParsePrivilegeEvent(t *testing.T) {
+	syscallNumberToName[59], syscallNumberToName[117] = "execve", "setresuid"
+	defer delete(syscallNumberToName, 59)
+	defer delete(syscallNumberToName, 117)
+
+	// setresuid(-1, 0, -1), denied
+	ev, ok := ParseAuditEvent([]AuditMessageTokenMap{
+		{AuditEventType: AUDIT_SYSCALL, Tokens: Tokenize(
+			`arch=c000003e syscall=117 success=no exit=-1 a0=ffffffff a1=0 a2=ffffffff a3=0 pid=7 uid=1000 euid=1000`)},
+	})
+	if !ok || ev.Name != PrivilegeEvent || !reflect.DeepEqual(ev.NewIDs, map[string]int{"euid": 0}) ||
+		!reflect.DeepEqual(ev.OldIDs, map[string]int{"euid": 1000}) {
+		t.Errorf("Unexpected setresuid event %+v", ev)
+	}
+
+	// A setuid program is a privilege event, with its command line
+	ev, ok = ParseAuditEvent([]AuditMessageTokenMap{
+		{AuditEventType: AUDIT_SYSCALL, Tokens: Tokenize(
+			`arch=c000003e syscall=59 success=yes exit=0 pid=8 uid=1000 euid=0 gid=1000 egid=1000 exe="/usr/bin/sudo"`)},
+		{AuditEventType: AUDIT_EXECVE, Tokens: Tokenize(`argc=2 a0="sudo" a1="id"`)},
+	})
+	if !ok || ev.Name != PrivilegeEvent || ev.Commandline != "sudo id" ||
+		!reflect.DeepEqual(ev.OldIDs, map[string]int{"euid": 1000}) ||
+		!reflect.DeepEqual(ev.NewIDs, map[string]int{"euid": 0}) {
+		t.Errorf("Unexpected setuid exec event %+v", ev)
+	}
+
+	// File capabilities
+	ev, ok = ParseAuditEvent([]AuditMessageTokenMap{
+		{AuditEventType: AUDIT_SYSCALL, Tokens: Tokenize(
+			`arch=c000003e syscall=59 success=yes exit=0 pid=9 uid=1000 euid=1000 exe="/usr/bin/ping"`)},
+		{AuditEventType: AUDIT_BPRM_FCAPS, Tokens: Tokenize(
+			`fver=2 fp=0000000000002000 fi=0 fe=1 old_pp=0 old_pi=0 old_pe=0 old_pa=0 pp=0000000000002000 pi=0 pe=0000000000002000 pa=0`)},
+	})
+	if !ok || ev.Name != PrivilegeEvent || ev.NewIDs != nil || ev.Capabilities == nil ||
+		!reflect.DeepEqual(ev.Capabilities.FilePermitted, []string{"cap_net_raw"}) ||
+		!reflect.DeepEqual(ev.Capabilities.Effective, []string{"cap_net_raw"}) {
+		t.Errorf("Unexpected file capabilities event %+v", ev)
+	}
+
+	// A plain exec stays a process event
+	ev, ok = ParseAuditEvent([]AuditMessageTokenMap{
+		{AuditEventType: AUDIT_SYSCALL, Tokens: Tokenize(
+			`arch=c000003e syscall=59 success=yes exit=0 pid=10 uid=1000 euid=1000 gid=1000 egid=1000`)},
+	})
+	if !ok || ev.Name != ProcessEvent || ev.NewIDs != nil {
+		t.Errorf("Unexpected exec event %+v", ev)
+	}
+}
+
+func TestCapabilitySetNames(t *testing.T) {
+	names := CapabilitySet(1<<0 | 1<<21 | 1<<63).Names()
+	if !reflect.DeepEqual(names, []string{"cap_chown", "cap_sys_admin", "cap_63"}) {
+		t.Errorf("Unexpected names %q", names)
+	}
+
+	if CapabilitySet(0).Names() != nil {
+		t.Error("An empty set has no names")
+	}
+}
+
+func TestParseKernelEvent(t *testing.T) {
+	syscallNumberToName[175], syscallNumberToName[176], syscallNumberToName[321] =
+		"init_module", "delete_module", "bpf"
+	defer delete(syscallNumberToName, 175)
+	defer delete(syscallNumberToName, 176)
+	defer delete(syscallNumberToName, 321)
+
+	tests := []struct {
+		records []AuditMessageTokenMap
+		op      string
+		module  string
+		progID  int
+	}{
+		{
+			[]AuditMessageTokenMap{
+				{AuditEventType: AUDIT_SYSCALL, Tokens: Tokenize(`syscall=175 success=yes pid=5 exe="/usr/bin/kmod"`)},
+				{AuditEventType: AUDIT_KERN_MODULE, Tokens: Tokenize(`name="rootkit"`)},
+			},
+			"LOAD", "rootkit", 0,
+		},
+		{
+			[]AuditMessageTokenMap{
+				{AuditEventType: AUDIT_SYSCALL, Tokens: Tokenize(`syscall=176 success=yes pid=5 exe="/usr/bin/kmod"`)},
+				{AuditEventType: AUDIT_KERN_MODULE, Tokens: Tokenize(`name="rootkit"`)},
+			},
+			"UNLOAD", "rootkit", 0,
+		},
+		{
+			[]AuditMessageTokenMap{
+				{AuditEventType: AUDIT_SYSCALL, Tokens: Tokenize(`syscall=321 success=yes pid=5 exe="/usr/bin/bpftool"`)},
+				{AuditEventType: AUDIT_BPF, Tokens: Tokenize(`prog-id=75 op=LOAD`)},
+			},
+			"LOAD", "", 75,
+		},
+		{
+			[]AuditMessageTokenMap{
+				{AuditEventType: AUDIT_BPF, Tokens: Tokenize(`prog-id=75 op=UNLOAD`)},
+			},
+			"UNLOAD", "", 75,
+		},
+		{
+			[]AuditMessageTokenMap{
+				{AuditEventType: AUDIT_SYSCALL, Tokens: Tokenize(`syscall=321 success=yes a0=5 pid=5 exe="/usr/bin/bpftool"`)},
+			},
+			"LOAD", "", 0,
+		},
+	}
+
+	for i, test := range tests {
+		ev, ok := ParseAuditEvent(test.records)
+		if !ok || ev.Name != KernelEvent || ev.Operation != test.op ||
+			ev.Module != test.module || ev.BpfProgID != test.progID {
+			t.Errorf("%d: unexpected event %+v", i, ev)
+		}
+	}
+
+	// A bpf map lookup loads nothing
+	ev, ok := ParseAuditEvent([]AuditMessageTokenMap{
+		{AuditEventType: AUDIT_SYSCALL, Tokens: Tokenize(`syscall=321 success=yes a0=1 pid=5 exe="/usr/bin/bpftool"`)},
+	})
+	if ok {
+		t.Errorf("Unexpected event %+v", ev)
+	}
+}
+
+func TestParseUserEvent(t *testing.T) {
+	tests := []struct {
+		msgType uint16
+		data    string
+		want    AuditEvent
+	}{
+		{
+			1112,
+			`pid=811 uid=0 auid=1000 ses=4 msg='op=login id=1000 exe="/usr/sbin/sshd" hostname=10.0.0.2 addr=10.0.0.2 terminal=/dev/pts/1 res=success'`,
+			AuditEvent{Type: "USER_LOGIN", Operation: "login", Pid: 811, Auid: 1000, Session: 4,
+				Exectuable: "/usr/sbin/sshd", Hostname: "10.0.0.2", Addr: "10.0.0.2",
+				Terminal: "/dev/pts/1", Res: "success", Success: "success"},
+		},
+		{
+			1103,
+			`pid=9 uid=0 auid=1000 ses=4 msg='op=PAM:setcred grantors=pam_env,pam_unix acct="root" exe="/usr/bin/sudo" hostname=? addr=? terminal=/dev/pts/1 res=success'`,
+			AuditEvent{Type: "CRED_ACQ", Operation: "PAM:setcred", Pid: 9, Auid: 1000, Session: 4,
+				Acct: "root", Grantors: []string{"pam_env", "pam_unix"}, Exectuable: "/usr/bin/sudo",
+				Hostname: "?", Addr: "?", Terminal: "/dev/pts/1", Res: "success", Success: "success"},
+		},
+		{
+			1123,
+			`pid=9 uid=1000 auid=1000 ses=4 msg='cwd="/home/u" cmd=6C73202D6C exe="/usr/bin/sudo" terminal=pts/1 res=success'`,
+			AuditEvent{Type: "USER_CMD", Pid: 9, Uid: 1000, Auid: 1000, Session: 4, Cwd: "/home/u",
+				Cmd: "ls -l", Exectuable: "/usr/bin/sudo", Terminal: "pts/1", Res: "success", Success: "success"},
+		},
+	}
+
+	for _, test := range tests {
+		ev, ok := ParseAuditEvent([]AuditMessageTokenMap{
+			{AuditEventType: test.msgType, Tokens: tokenizeRecord(test.msgType, test.data)},
+		})
+		if !ok {
+			t.Fatalf("%d: expected a user event", test.msgType)
+		}
+
+		test.want.Name = UserEvent
+		test.want.Msg = ev.Msg
+		if !reflect.DeepEqual(*ev, test.want) {
+			t.Errorf("%d: expected %+v, got %+v", test.msgType, test.want, *ev)
+		}
+	}
+}
+
+func TestParseMacEvent(t *testing.T) {
+	syscallNumberToName[4] = "stat"
+	defer delete(syscallNumberToName, 4)
+
+	tests := []struct {
+		records []*AuditMessage
+		want    AuditEvent
+	}{
+		{
+			[]*AuditMessage{
+				{Type: AUDIT_AVC, Data: `avc:  denied  { read } for  pid=12 comm="httpd" name="shadow" dev="dm-0" ino=1 scontext=system_u:system_r:httpd_t:s0 tcontext=system_u:object_r:shadow_t:s0 tclass=file permissive=0`},
+				{Type: AUDIT_SYSCALL, Data: `arch=c000003e syscall=4 success=no exit=-13 pid=12 uid=48 comm="httpd" exe="/usr/sbin/httpd"`},
+			},
+			AuditEvent{Arch: "c000003e", Success: "no", Exit: -13, Syscall: "stat", Pid: 12, Uid: 48, Comm: "httpd", Exectuable: "/usr/sbin/httpd",
+				Res: "denied", Permissions: []string{"read"}, Path: "shadow",
+				SourceContext: "system_u:system_r:httpd_t:s0", TargetContext: "system_u:object_r:shadow_t:s0",
+				Class: "file"},
+		},
+		{
+			[]*AuditMessage{
+				{Type: AUDIT_AVC, Data: `apparmor="DENIED" operation="open" profile="/usr/sbin/cupsd" name="/etc/shadow" pid=99 comm="cupsd" requested_mask="r" denied_mask="r" fsuid=0 ouid=0`},
+			},
+			AuditEvent{Pid: 99, Comm: "cupsd", Res: "denied", Permissions: []string{"r"}, Path: "/etc/shadow",
+				Profile: "/usr/sbin/cupsd", Operation: "open"},
+		},
+		{
+			[]*AuditMessage{
+				{Type: AUDIT_USER_AVC, Data: `pid=700 uid=81 auid=4294967295 ses=4294967295 msg='avc:  denied  { send_msg } for msgtype=method_call scontext=a tcontext=b tclass=dbus permissive=1 exe="/usr/bin/dbus-daemon" sauid=81 hostname=? addr=? terminal=?'`},
+			},
+			AuditEvent{Pid: 700, Uid: 81, Auid: 4294967295, Session: 4294967295, Exectuable: "/usr/bin/dbus-daemon",
+				Res: "denied", Permissions: []string{"send_msg"}, SourceContext: "a", TargetContext: "b",
+				Class: "dbus", Permissive: true},
+		},
+	}
+
+	for i, test := range tests {
+		ev, ok := ParseAuditMessageGroup(&AuditMessageGroup{Msgs: test.records})
+		if !ok {
+			t.Fatalf("%d: expected a mac event", i)
+		}
+
+		test.want.Name = MacEvent
+		if !reflect.DeepEqual(*ev, test.want) {
+			t.Errorf("%d: expected %+v, got %+v", i, test.want, *ev)
+		}
+	}
+
+	// The AppArmor types past the known ones don't crash the parser
+	for _, typ := range []uint16{1508, 1599} {
+		ParseAuditMessageGroup(&AuditMessageGroup{Msgs: []*AuditMessage{{Type: typ, Data: `pid=1`}}})
+	}
+}
+
+func TestParseMacDecisionOfSyscallEvent(t *testing.T) {
+	syscallNumberToName[59], syscallNumberToName[257] = "execve", "openat"
+	fimSyscalls[257] = true
+	defer delete(syscallNumberToName, 59)
+	defer delete(syscallNumberToName, 257)
+	defer delete(fimSyscalls, 257)
+
+	// An exec allowed in permissive mode stays a process event
+	ev, ok := ParseAuditMessageGroup(&AuditMessageGroup{Msgs: []*AuditMessage{
+		{Type: AUDIT_AVC, Data: `avc:  denied  { execute } for  pid=5 comm="sh" name="id" scontext=a tcontext=b tclass=file permissive=1`},
+		{Type: AUDIT_SYSCALL, Data: `arch=c000003e syscall=59 success=yes exit=0 pid=5 uid=0 comm="id" exe="/usr/bin/id"`},
+		{Type: AUDIT_EXECVE, Data: `argc=1 a0="id"`},
+	}})
+	if !ok || ev.Name != ProcessEvent || ev.Commandline != "id" || ev.Res != "denied" ||
+		!ev.Permissive || !reflect.DeepEqual(ev.Permissions, []string{"execute"}) {
+		t.Errorf("Unexpected exec event %+v", ev)
+	}
+
+	// A file opened in AppArmor complain mode stays a FIM event
+	ev, ok = ParseAuditMessageGroup(&AuditMessageGroup{Msgs: []*AuditMessage{
+		{Type: AUDIT_SYSCALL, Data: `arch=c000003e syscall=257 success=yes exit=3 pid=6 uid=0 comm="cat" exe="/usr/bin/cat"`},
+		{Type: AUDIT_AVC, Data: `apparmor="ALLOWED" operation="open" profile="/usr/bin/cat" name="/etc/shadow" pid=6 comm="cat" requested_mask="r" denied_mask="r" fsuid=0 ouid=0`},
+		{Type: AUDIT_CWD, Data: `cwd="/"`},
+		{Type: AUDIT_PATH, Data: `item=0 name="/etc" inode=1 nametype=PARENT`},
+		{Type: AUDIT_PATH, Data: `item=1 name="/etc/shadow" inode=2 nametype=NORMAL`},
+	}})
+	if !ok || ev.Name != FIMEvent || ev.Path != "/etc/shadow" || ev.Profile != "/usr/bin/cat" ||
+		ev.Operation != "open" {
+		t.Errorf("Unexpected file event %+v", ev)
+	}
+}
+
+func TestParseSeccompEvent(t *testing.T) {
+	syscallNumberToName[41] = "socket"
+	defer delete(syscallNumberToName, 41)
+
+	tests := []struct {
+		data    string
+		syscall string
+		action  string
+		exit    int
+	}{
+		{`auid=1000 uid=1000 gid=1000 ses=2 pid=77 comm="curl" exe="/usr/bin/curl" sig=31 arch=c000003e syscall=41 compat=0 ip=0x7f3a code=0x80000000`,
+			"socket", "KILL_PROCESS", 0},
+		{`auid=1000 uid=1000 gid=1000 ses=2 pid=77 comm="curl" exe="/usr/bin/curl" sig=0 arch=c000003e syscall=41 compat=0 ip=0x7f3a code=0x50001`,
+			"socket", "ERRNO", -1},
+		{`auid=1000 uid=1000 gid=1000 ses=2 pid=77 comm="curl" exe="/usr/bin/curl" sig=0 arch=40000003 syscall=41 compat=1 ip=0x7f3a code=0x7ffc0000`,
+			"41", "LOG", 0},
+	}
+
+	for i, test := range tests {
+		ev, ok := ParseAuditMessageGroup(&AuditMessageGroup{Msgs: []*AuditMessage{
+			{Type: AUDIT_SECCOMP, Data: test.data, Containers: map[string]string{"docker": "abc"}},
+		}})
+		if !ok || ev.Name != SeccompEvent || ev.Syscall != test.syscall || ev.Action != test.action ||
+			ev.Exit != test.exit || ev.Exectuable != "/usr/bin/curl" || ev.Containers["docker"] != "abc" {
+			t.Errorf("%d: unexpected event %+v", i, ev)
+		}
+	}
+
+	if action := SeccompAction(0x12340000); action != "0x12340000" {
+		t.Errorf("Unexpected unknown action %s", action)
+	}
+}
+
+func TestParseAnomalyIntegrityEvent(t *testing.T) {
+	syscallNumberToName[265], syscallNumberToName[16] = "linkat", "ioctl"
+	defer delete(syscallNumberToName, 265)
+	defer delete(syscallNumberToName, 16)
+
+	tests := []struct {
+		records []*AuditMessage
+		want    AuditEvent
+	}{
+		{
+			[]*AuditMessage{
+				{Type: AUDIT_ANOM_ABEND, Data: `auid=1000 uid=1000 gid=1000 ses=2 subj=unconfined pid=9 comm="a.out" exe="/tmp/a.out" sig=11 res=1`},
+			},
+			AuditEvent{Name: AnomalyEvent, Type: "ANOM_ABEND", Pid: 9, Auid: 1000, Uid: 1000, Gid: 1000, Session: 2,
+				Comm: "a.out", Exectuable: "/tmp/a.out", Signal: 11, Res: "1"},
+		},
+		{
+			[]*AuditMessage{
+				{Type: AUDIT_SYSCALL, Data: `arch=c000003e syscall=16 success=yes exit=0 pid=5 uid=0 comm="ip" exe="/usr/sbin/ip"`},
+				{Type: AUDIT_ANOM_PROMISCUOUS, Data: `dev=eth0 prom=256 old_prom=0 auid=0 uid=0 gid=0 ses=1`},
+			},
+			AuditEvent{Name: AnomalyEvent, Type: "ANOM_PROMISCUOUS", Arch: "c000003e", Syscall: "ioctl",
+				Success: "yes", Pid: 5, Comm: "ip", Exectuable: "/usr/sbin/ip", Device: "eth0",
+				Operation: "promiscuous_on"},
+		},
+		{
+			[]*AuditMessage{
+				{Type: AUDIT_SYSCALL, Data: `arch=c000003e syscall=265 success=no exit=-1 pid=6 uid=1000 comm="ln" exe="/usr/bin/ln"`},
+				{Type: AUDIT_ANOM_LINK, Data: `op=linkat ppid=1 pid=6 auid=1000 uid=1000 gid=1000 ses=2 comm="ln" exe="/usr/bin/ln" res=0`},
+				{Type: AUDIT_CWD, Data: `cwd="/tmp"`},
+				{Type: AUDIT_PATH, Data: `item=0 name="shadow" inode=1`},
+			},
+			AuditEvent{Name: AnomalyEvent, Type: "ANOM_LINK", Arch: "c000003e", Syscall: "linkat",
+				Success: "no", Exit: -1, Pid: 6, Uid: 1000, Comm: "ln", Exectuable: "/usr/bin/ln",
+				Operation: "linkat", Res: "0", Cwd: "/tmp", Path: "/tmp/shadow"},
+		},
+		{
+			[]*AuditMessage{
+				{Type: AUDIT_INTEGRITY_DATA, Data: `pid=3 uid=0 auid=0 ses=1 subj=unconfined op=appraise_data cause=invalid-hash comm="bash" name="/usr/bin/evil" dev="sda1" ino=4 res=0 errno=0`},
+			},
+			AuditEvent{Name: IntegrityEvent, Type: "INTEGRITY_DATA", Pid: 3, Session: 1, Comm: "bash",
+				Operation: "appraise_data", Cause: "invalid-hash", Path: "/usr/bin/evil", Res: "0"},
+		},
+		{
+			[]*AuditMessage{
+				{Type: AUDIT_INTEGRITY_RULE, Data: `file="/usr/bin/x" hash="sha256:abcd" ppid=1 pid=5 auid=0 uid=0 ses=1 comm="sh"`},
+			},
+			AuditEvent{Name: IntegrityEvent, Type: "INTEGRITY_RULE", Pid: 5, Session: 1, Comm: "sh",
+				Path: "/usr/bin/x", Hash: "sha256:abcd"},
+		},
+	}
+
+	for i, test := range tests {
+		ev, ok := ParseAuditMessageGroup(&AuditMessageGroup{Msgs: test.records})
+		if !ok {
+			t.Fatalf("%d: expected an event", i)
+		}
+
+		if !reflect.DeepEqual(*ev, test.want) {
+			t.Errorf("%d: expected %+v, got %+v", i, test.want, *ev)
+		}
+	}
+
+	// An exec measured by an IMA audit policy stays a process event
+	syscallNumberToName[59] = "execve"
+	defer delete(syscallNumberToName, 59)
+
+	ev, ok := ParseAuditMessageGroup(&AuditMessageGroup{Msgs: []*AuditMessage{
+		{Type: AUDIT_INTEGRITY_RULE, Data: `file="/usr/bin/x" hash="sha256:abcd" ppid=1 pid=5 auid=0 uid=0 ses=1 comm="x"`},
+		{Type: AUDIT_SYSCALL, Data: `arch=c000003e syscall=59 success=yes exit=0 ppid=1 pid=5 uid=0 comm="x" exe="/usr/bin/x"`},
+		{Type: AUDIT_EXECVE, Data: `argc=2 a0="x" a1="-v"`},
+	}})
+	if !ok || ev.Name != ProcessEvent || ev.Commandline != "x -v" || ev.Type != "INTEGRITY_RULE" ||
+		ev.Hash != "sha256:abcd" {
+		t.Errorf("Unexpected exec event %+v", ev)
+	}
+}
+
+func TestParseConfigEvent(t *testing.T) {
+	ProtectRuleKeys("auditrd")
+	defer delete(protectedKeys, "auditrd")
+
+	tests := []struct {
+		records []*AuditMessage
+		want    AuditEvent
+	}{
+		{
+			[]*AuditMessage{
+				{Type: AUDIT_CONFIG_CHANGE, Data: `auid=1000 ses=3 subj=unconfined op=remove_rule key="auditrd" list=4 res=1`},
+			},
+			AuditEvent{Name: ConfigEvent, Type: "CONFIG_CHANGE", Auid: 1000, Session: 3, Operation: "remove_rule",
+				Key: "auditrd", List: "exit", Res: "1", Alert: true},
+		},
+		{
+			[]*AuditMessage{
+				{Type: AUDIT_CONFIG_CHANGE, Data: `auid=1000 ses=3 subj=unconfined op=add_rule key=(null) list=4 res=1`},
+			},
+			AuditEvent{Name: ConfigEvent, Type: "CONFIG_CHANGE", Auid: 1000, Session: 3, Operation: "add_rule",
+				List: "exit", Res: "1"},
+		},
+		{
+			[]*AuditMessage{
+				{Type: AUDIT_CONFIG_CHANGE, Data: `op=set audit_enabled=0 old=1 auid=0 ses=1 subj=unconfined res=1`},
+			},
+			AuditEvent{Name: ConfigEvent, Type: "CONFIG_CHANGE", Session: 1, Operation: "set",
+				Setting: "audit_enabled", Value: "0", OldValue: "1", Res: "1"},
+		},
+		{
+			[]*AuditMessage{
+				{Type: AUDIT_FEATURE_CHANGE, Data: `pid=7 uid=0 auid=0 ses=1 subj=unconfined comm="auditctl" exe="/sbin/auditctl" feature=loginuid_immutable old=0 new=1 old_lock=0 new_lock=0 res=1`},
+			},
+			AuditEvent{Name: ConfigEvent, Type: "FEATURE_CHANGE", Pid: 7, Session: 1, Comm: "auditctl",
+				Exectuable: "/sbin/auditctl", Setting: "loginuid_immutable", Value: "1", OldValue: "0", Res: "1"},
+		},
+		{
+			[]*AuditMessage{
+				{Type: AUDIT_DAEMON_ABORT, Data: `op=abort reason=disk-full auid=4294967295 pid=810 uid=0 ses=4294967295 res=failed`},
+			},
+			AuditEvent{Name: ConfigEvent, Type: "DAEMON_ABORT", Pid: 810, Auid: 4294967295, Session: 4294967295,
+				Operation: "abort", Res: "failed"},
+		},
+	}
+
+	for i, test := range tests {
+		ev, ok := ParseAuditMessageGroup(&AuditMessageGroup{Msgs: test.records})
+		if !ok {
+			t.Fatalf("%d: expected an event", i)
+		}
+
+		if !reflect.DeepEqual(*ev, test.want) {
+			t.Errorf("%d: expected %+v, got %+v", i, test.want, *ev)
+		}
+	}
+}
+
+func TestParseTargetEvent(t *testing.T) {
+	syscallNumberToName[101], syscallNumberToName[62], syscallNumberToName[311] = "ptrace", "kill", "process_vm_writev"
+	defer delete(syscallNumberToName, 101)
+	defer delete(syscallNumberToName, 62)
+	defer delete(syscallNumberToName, 311)
+
+	tests := []struct {
+		records []*AuditMessage
+		want    AuditEvent
+	}{
+		{
+			[]*AuditMessage{
+				{Type: AUDIT_SYSCALL, Data: `arch=c000003e syscall=101 success=yes exit=0 a0=10 a1=4d2 a2=0 a3=0 pid=40 auid=1000 uid=1000 ses=2 comm="gdb" exe="/usr/bin/gdb"`},
+				{Type: AUDIT_OBJ_PID, Data: `opid=1234 oauid=1000 ouid=0 oses=3 obj=unconfined ocomm="sshd"`},
+			},
+			AuditEvent{Name: TargetEvent, Arch: "c000003e", Syscall: "ptrace", Success: "yes", Pid: 40,
+				Auid: 1000, Uid: 1000, Session: 2, Comm: "gdb", Exectuable: "/usr/bin/gdb", Operation: "PTRACE_ATTACH",
+				Targets: []ProcessTarget{{Pid: 1234, Auid: 1000, Session: 3, Comm: "sshd", Context: "unconfined"}}},
+		},
+		{
+			[]*AuditMessage{
+				{Type: AUDIT_SYSCALL, Data: `arch=c000003e syscall=62 success=yes exit=0 a0=ffffffff a1=9 a2=0 a3=0 pid=41 uid=0 comm="kill"`},
+				{Type: AUDIT_OBJ_PID, Data: `opid=500 oauid=0 ouid=0 oses=1 ocomm="auditd"`},
+				{Type: AUDIT_OBJ_PID, Data: `opid=501 oauid=0 ouid=33 oses=1 ocomm="nginx"`},
+			},
+			AuditEvent{Name: TargetEvent, Arch: "c000003e", Syscall: "kill", Success: "yes", Pid: 41,
+				Comm: "kill", Signal: 9, Targets: []ProcessTarget{{Pid: 500, Session: 1, Comm: "auditd"},
+					{Pid: 501, Uid: 33, Session: 1, Comm: "nginx"}}},
+		},
+		{
+			[]*AuditMessage{
+				{Type: AUDIT_SYSCALL, Data: `arch=c000003e syscall=311 success=yes exit=8 a0=4d2 a1=7ffd a2=1 a3=7ffe pid=42 uid=0 comm="inject"`},
+			},
+			AuditEvent{Name: TargetEvent, Arch: "c000003e", Syscall: "process_vm_writev", Success: "yes", Exit: 8,
+				Pid: 42, Comm: "inject", Targets: []ProcessTarget{{Pid: 1234}}},
+		},
+	}
+
+	for i, test := range tests {
+		ev, ok := ParseAuditMessageGroup(&AuditMessageGroup{Msgs: test.records})
+		if !ok {
+			t.Fatalf("%d: expected an event", i)
+		}
+
+		if !reflect.DeepEqual(*ev, test.want) {
+			t.Errorf("%d: expected %+v, got %+v", i, test.want, *ev)
+		}
+	}
+}
+
+func TestParseIPCEvent(t *testing.T) {
+	syscallNumberToName[71], syscallNumberToName[240] = "msgctl", "mq_open"
+	defer delete(syscallNumberToName, 71)
+	defer delete(syscallNumberToName, 240)
+
+	newOuid, newOgid := 1000, 1000
+	tests := []struct {
+		records []*AuditMessage
+		want    AuditEvent
+	}{
+		{
+			[]*AuditMessage{
+				{Type: AUDIT_SYSCALL, Data: `arch=c000003e syscall=71 success=yes exit=0 a0=8000 a1=1 a2=0 a3=0 pid=50 uid=0 comm="ipcs"`},
+				{Type: AUDIT_IPC, Data: `ouid=0 ogid=0 mode=0600`},
+				{Type: AUDIT_IPC_SET_PERM, Data: `qbytes=4000 ouid=1000 ogid=1000 mode=0666`},
+			},
+			AuditEvent{Name: IPCEvent, Arch: "c000003e", Syscall: "msgctl", Success: "yes", Pid: 50, Comm: "ipcs",
+				IPC: &IPCObject{Mode: "0600", NewOuid: &newOuid, NewOgid: &newOgid, NewMode: "0666", QBytes: 0x4000}},
+		},
+		{
+			[]*AuditMessage{
+				{Type: AUDIT_SYSCALL, Data: `arch=c000003e syscall=240 success=yes exit=3 a0=55 a1=42 a2=1ff a3=0 pid=51 uid=1000 comm="mq"`},
+				{Type: AUDIT_MQ_OPEN, Data: `oflag=0x42 mode=0777 mq_flags=0x0 mq_maxmsg=10 mq_msgsize=8192 mq_curmsgs=0`},
+			},
+			AuditEvent{Name: IPCEvent, Arch: "c000003e", Syscall: "mq_open", Success: "yes", Exit: 3, Pid: 51,
+				Uid: 1000, Comm: "mq", Mqueue: &Mqueue{OFlag: 0x42, Mode: "0777", MaxMsg: 10, MsgSize: 8192}},
+		},
+	}
+
+	for i, test := range tests {
+		ev, ok := ParseAuditMessageGroup(&AuditMessageGroup{Msgs: test.records})
+		if !ok {
+			t.Fatalf("%d: expected an event", i)
+		}
+
+		if !reflect.DeepEqual(*ev, test.want) {
+			t.Errorf("%d: expected %+v, got %+v", i, test.want, *ev)
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package auditrd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// DispatcherFormat is the format auditd sends the events to its plugins in,
+// the format setting of the plugin conf.
+type DispatcherFormat int
+
+const (
+	// DispatcherString is the text format of the log files, one record per
+	// line
+	DispatcherString DispatcherFormat = iota
+	// DispatcherBinary is a struct audit_dispatcher_header followed by the
+	// record
+	DispatcherBinary
+)
+
+// Versions of the binary dispatcher protocol
+const (
+	AUDISP_PROTOCOL_VER  uint32 = 0
+	AUDISP_PROTOCOL_VER2 uint32 = 1
+)
+
+// auditDispatcherHeader is struct audit_dispatcher_header, see
+// https://github.com/linux-audit/audit-userspace/blob/master/lib/libaudit.h
+type auditDispatcherHeader struct {
+	Ver  uint32 // The version of this protocol
+	Hlen uint32 // Header length
+	Type uint32 // Message type
+	Size uint32 // Size of data following the header
+}
+
+const sizeofAuditDispatcherHeader = 16
+
+// dispatcherResult is a record read by the dispatcher source
+type dispatcherResult struct {
+	msg *AuditMessage
+	err error
+}
+
+// dispatcherSource reads the records auditd sends to a plugin
+type dispatcherSource struct {
+	r       io.Reader
+	format  DispatcherFormat
+	records chan dispatcherResult
+
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+// NewDispatcherSource returns a Source reading the records auditd sends to a
+// plugin, usually on stdin, in the given format. The reads happen in the
+// background so that Close doesn't wait for the next record. The reader is
+// closed along with the source if it's an io.Closer.
+func NewDispatcherSource(r io.Reader, format DispatcherFormat) Source {
+	d := &dispatcherSource{
+		r:       r,
+		format:  format,
+		records: make(chan dispatcherResult, RECEIVE_QUEUE_SIZE),
+		closed:  make(chan struct{}),
+	}
+
+	go d.readLoop()
+	return d
+}
+
+// NewDispatcherReader groups the records auditd sends to a plugin, see
+// NewDispatcherSource. The reader stops once auditd closes the stream.
+func NewDispatcherReader(ctx context.Context, r io.Reader, format DispatcherFormat, opts ...ReaderOption) (*AuditReader, error) {
+	return NewSourceReader(ctx, NewDispatcherSource(r, format), opts...)
+}
+
+func (d *dispatcherSource) Next() (*AuditMessage, error) {
+	select {
+	case r, ok := <-d.records:
+		if !ok {
+			return nil, io.EOF
+		}
+		return r.msg, r.err
+	case <-d.closed:
+		return nil, io.EOF
+	}
+}
+
+func (d *dispatcherSource) Close() error {
+	var err error
+	d.closeOnce.Do(func() {
+		close(d.closed)
+		if c, ok := d.r.(io.Closer); ok {
+			err = c.Close()
+		}
+	})
+	return err
+}
+
+func (d *dispatcherSource) readLoop() {
+	defer close(d.records)
+
+	read := d.readString
+	if d.format == DispatcherBinary {
+		read = d.readBinary
+	}
+
+	br := bufio.NewReaderSize(d.r, MAX_AUDIT_MESSAGE_LENGTH)
+	for {
+		// A bad record is reported and skipped, an error reading the stream
+		// stops the source.
+		msg, bad, err := read(br)
+		if err == io.EOF {
+			return
+		}
+
+		if err != nil {
+			bad = err
+		}
+
+		select {
+		case d.records <- dispatcherResult{msg, bad}:
+		case <-d.closed:
+			return
+		}
+
+		if err != nil {
+			return
+		}
+	}
+}
+
+// readString reads a line of the string format, which is the log file format
+func (d *dispatcherSource) readString(br *bufio.Reader) (msg *AuditMessage, bad, err error) {
+	for {
+		line, err := br.ReadBytes('\n')
+		if err != nil && (err != io.EOF || len(line) == 0) {
+			return nil, nil, err
+		}
+
+		line = bytes.TrimRight(line, "\n")
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+
+		if msg, bad = parseLogRecord(line); bad != nil {
+			return nil, fmt.Errorf("Bad dispatcher record: %s", bad), nil
+		}
+		return msg, nil, nil
+	}
+}
+
+// readBinary reads a header and the record following it
+func (d *dispatcherSource) readBinary(br *bufio.Reader) (msg *AuditMessage, bad, err error) {
+	var h auditDispatcherHeader
+	if err := binary.Read(br, endianness, &h); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return nil, nil, fmt.Errorf("Truncated dispatcher header")
+		}
+		return nil, nil, err
+	}
+
+	// The stream can't be resynchronized after a bad header
+	if h.Ver != AUDISP_PROTOCOL_VER && h.Ver != AUDISP_PROTOCOL_VER2 {
+		return nil, nil, fmt.Errorf("Unsupported dispatcher protocol version %d", h.Ver)
+	}
+
+	if h.Hlen < sizeofAuditDispatcherHeader || h.Size > MAX_AUDIT_MESSAGE_LENGTH*4 {
+		return nil, nil, fmt.Errorf("Invalid dispatcher header %+v", h)
+	}
+
+	// Skip what newer headers may add
+	if _, err := br.Discard(int(h.Hlen - sizeofAuditDispatcherHeader)); err != nil {
+		return nil, nil, err
+	}
+
+	data := make([]byte, h.Size)
+	if _, err := io.ReadFull(br, data); err != nil {
+		return nil, nil, fmt.Errorf("Truncated dispatcher record: %s", err)
+	}
+
+	msg = newRecordMessage(uint16(h.Type), bytes.TrimRight(data, "\x00\n"))
+	if msg.Seq == 0 {
+		return nil, fmt.Errorf("Bad dispatcher record: missing header"), nil
+	}
+
+	return msg, nil, nil
+}
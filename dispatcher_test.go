@@ -0,0 +1,73 @@
+package auditrd
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"strings"
+	"testing"
+)
+
+func dispatcherRecord(ver, msgType uint32, data string) []byte {
+	buf := new(bytes.Buffer)
+	binary.Write(buf, endianness, &auditDispatcherHeader{
+		Ver:  ver,
+		Hlen: sizeofAuditDispatcherHeader,
+		Type: msgType,
+		Size: uint32(len(data)),
+	})
+	buf.WriteString(data)
+	return buf.Bytes()
+}
+
+func TestDispatcherSourceBinary(t *testing.T) {
+	stream := new(bytes.Buffer)
+	stream.Write(dispatcherRecord(AUDISP_PROTOCOL_VER2, uint32(AUDIT_CWD),
+		`audit(1621634984.633:49129): cwd="/etc"`+"\x00"))
+	stream.Write(dispatcherRecord(AUDISP_PROTOCOL_VER, uint32(AUDIT_CWD), "garbage"))
+	stream.Write(dispatcherRecord(AUDISP_PROTOCOL_VER, uint32(AUDIT_EOE),
+		`audit(1621634984.633:49129): `))
+	stream.Write(dispatcherRecord(7, uint32(AUDIT_CWD), "bad version"))
+
+	src := NewDispatcherSource(stream, DispatcherBinary)
+	defer src.Close()
+
+	msg, err := src.Next()
+	if err != nil || msg.Type != AUDIT_CWD || msg.Seq != 49129 || msg.Data != `cwd="/etc"` {
+		t.Errorf("Unexpected record %+v, %v", msg, err)
+	}
+
+	if _, err := src.Next(); err == nil {
+		t.Error("Expected an error for the record without header")
+	}
+
+	if msg, err := src.Next(); err != nil || msg.Type != AUDIT_EOE {
+		t.Errorf("Expected the EOE record, got %+v, %v", msg, err)
+	}
+
+	// A bad header stops the stream
+	if _, err := src.Next(); err == nil {
+		t.Error("Expected an error for the bad version")
+	}
+	if _, err := src.Next(); err != io.EOF {
+		t.Errorf("Expected io.EOF, got %v", err)
+	}
+}
+
+func TestDispatcherReaderString(t *testing.T) {
+	rd, err := NewDispatcherReader(context.Background(),
+		strings.NewReader(testLog), DispatcherString)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var seqs []uint64
+	for g := range rd.Events() {
+		seqs = append(seqs, g.Seq)
+	}
+
+	if len(seqs) != 2 || seqs[0] != 49129 || seqs[1] != 49130 {
+		t.Errorf("Unexpected groups %v", seqs)
+	}
+}
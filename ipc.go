@@ -0,0 +1,154 @@
+package auditrd
+
+// IpcRecord is the AUDIT_IPC record, the owner and mode of the SysV message
+// queue, semaphore set or shared memory segment a syscall accessed, or the
+// AUDIT_IPC_SET_PERM record, the ones set by an IPC_SET and the queue size.
+type IpcRecord struct {
+	RecordFields
+	Ouid    int    `json:"ouid"`
+	Ogid    int    `json:"ogid"`
+	Mode    uint32 `json:"mode"`
+	Context string `json:"context,omitempty"`
+	QBytes  uint64 `json:"qbytes,omitempty"`
+}
+
+// MqOpenRecord is the AUDIT_MQ_OPEN record, the flags, mode and attributes a
+// POSIX message queue is created with.
+type MqOpenRecord struct {
+	RecordFields
+	OFlag   uint64 `json:"oflag"`
+	Mode    uint32 `json:"mode"`
+	Flags   uint64 `json:"mq_flags"`
+	MaxMsg  int    `json:"mq_maxmsg"`
+	MsgSize int    `json:"mq_msgsize"`
+	CurMsgs int    `json:"mq_curmsgs"`
+}
+
+// MqSendRecvRecord is the AUDIT_MQ_SENDRECV record, a message sent to or
+// received from a POSIX message queue.
+type MqSendRecvRecord struct {
+	RecordFields
+	Mqdes    int `json:"mqdes"`
+	MsgLen   int `json:"msg_len"`
+	MsgPrio  int `json:"msg_prio"`
+	Sec      int `json:"abs_timeout_sec"`
+	Nanosecs int `json:"abs_timeout_nsec"`
+}
+
+// MqNotifyRecord is the AUDIT_MQ_NOTIFY record, the signal registered to be
+// sent when a message arrives on a POSIX message queue.
+type MqNotifyRecord struct {
+	RecordFields
+	Mqdes int `json:"mqdes"`
+	Signo int `json:"sigev_signo"`
+}
+
+// MqGetSetAttrRecord is the AUDIT_MQ_GETSETATTR record, the attributes of a
+// POSIX message queue read or set by mq_getsetattr.
+type MqGetSetAttrRecord struct {
+	RecordFields
+	Mqdes   int    `json:"mqdes"`
+	Flags   uint64 `json:"mq_flags"`
+	MaxMsg  int    `json:"mq_maxmsg"`
+	MsgSize int    `json:"mq_msgsize"`
+	CurMsgs int    `json:"mq_curmsgs"`
+}
+
+// IPCObject is the SysV IPC object of an ipc event, with the owner and mode
+// set by an IPC_SET in the New fields.
+type IPCObject struct {
+	Ouid    int    `json:"ouid"`
+	Ogid    int    `json:"ogid"`
+	Mode    string `json:"mode"`
+	Context string `json:"context,omitempty"`
+	NewOuid *int   `json:"new_ouid,omitempty"`
+	NewOgid *int   `json:"new_ogid,omitempty"`
+	NewMode string `json:"new_mode,omitempty"`
+	QBytes  uint64 `json:"qbytes,omitempty"`
+}
+
+// Mqueue is the POSIX message queue of an ipc event, from whichever MQ_*
+// record the syscall logged.
+type Mqueue struct {
+	Mqdes   int    `json:"mqdes,omitempty"`
+	OFlag   uint64 `json:"oflag,omitempty"`
+	Mode    string `json:"mode,omitempty"`
+	Flags   uint64 `json:"flags,omitempty"`
+	MaxMsg  int    `json:"max_msg,omitempty"`
+	MsgSize int    `json:"msg_size,omitempty"`
+	CurMsgs int    `json:"cur_msgs,omitempty"`
+	MsgLen  int    `json:"msg_len,omitempty"`
+	MsgPrio int    `json:"msg_prio,omitempty"`
+	Signal  int    `json:"signal,omitempty"`
+}
+
+func decodeIpc(r RecordFields) AuditRecord {
+	return &IpcRecord{
+		RecordFields: r,
+		Ouid:         r.int("ouid"),
+		Ogid:         r.int("ogid"),
+		Mode:         r.mode("mode"),
+		Context:      r.str("obj"),
+		QBytes:       r.hex("qbytes"),
+	}
+}
+
+func decodeMqOpen(r RecordFields) AuditRecord {
+	return &MqOpenRecord{
+		RecordFields: r,
+		OFlag:        r.hex("oflag"),
+		Mode:         r.mode("mode"),
+		Flags:        r.hex("mq_flags"),
+		MaxMsg:       r.int("mq_maxmsg"),
+		MsgSize:      r.int("mq_msgsize"),
+		CurMsgs:      r.int("mq_curmsgs"),
+	}
+}
+
+func decodeMqSendRecv(r RecordFields) AuditRecord {
+	return &MqSendRecvRecord{
+		RecordFields: r,
+		Mqdes:        r.int("mqdes"),
+		MsgLen:       r.int("msg_len"),
+		MsgPrio:      r.int("msg_prio"),
+		Sec:          r.int("abs_timeout_sec"),
+		Nanosecs:     r.int("abs_timeout_nsec"),
+	}
+}
+
+func decodeMqNotify(r RecordFields) AuditRecord {
+	return &MqNotifyRecord{
+		RecordFields: r,
+		Mqdes:        r.int("mqdes"),
+		Signo:        r.int("sigev_signo"),
+	}
+}
+
+func decodeMqGetSetAttr(r RecordFields) AuditRecord {
+	return &MqGetSetAttrRecord{
+		RecordFields: r,
+		Mqdes:        r.int("mqdes"),
+		Flags:        r.hex("mq_flags"),
+		MaxMsg:       r.int("mq_maxmsg"),
+		MsgSize:      r.int("mq_msgsize"),
+		CurMsgs:      r.int("mq_curmsgs"),
+	}
+}
+
+// newMqueue returns the message queue of an MQ_* record
+func newMqueue(rec AuditRecord) *Mqueue {
+	switch r := rec.(type) {
+	case *MqOpenRecord:
+		return &Mqueue{OFlag: r.OFlag, Mode: r.str("mode"), Flags: r.Flags, MaxMsg: r.MaxMsg,
+			MsgSize: r.MsgSize, CurMsgs: r.CurMsgs}
+	case *MqSendRecvRecord:
+		return &Mqueue{Mqdes: r.Mqdes, MsgLen: r.MsgLen, MsgPrio: r.MsgPrio}
+	case *MqNotifyRecord:
+		return &Mqueue{Mqdes: r.Mqdes, Signal: r.Signo}
+	case *MqGetSetAttrRecord:
+		return &Mqueue{Mqdes: r.Mqdes, Flags: r.Flags, MaxMsg: r.MaxMsg, MsgSize: r.MsgSize,
+			CurMsgs: r.CurMsgs}
+	}
+
+	return nil
+}
@@ -0,0 +1,215 @@
+package auditrd
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// enrichedSeparator starts the fields auditd appends with log_format=ENRICHED
+const enrichedSeparator = 0x1d
+
+// MAX_LOG_LINE_LENGTH bounds the lines of a log file, the longer ones are
+// skipped with ErrLineTooLong.
+const MAX_LOG_LINE_LENGTH = MAX_AUDIT_MESSAGE_LENGTH * 4
+
+// ErrLineTooLong is returned by a log file source for a skipped line
+var ErrLineTooLong = errors.New("Log line too long")
+
+// NewLogFileReader replays auditd log files, in order, through the same
+// grouping as NewAuditReader. Once the last file is read the pending groups are
+// flushed and the Events channel is closed.
+func NewLogFileReader(ctx context.Context, paths []string, opts ...ReaderOption) (*AuditReader, error) {
+	return NewSourceReader(ctx, NewLogFileSource(paths), opts...)
+}
+
+// NewLogFileSource returns a Source reading the records of auditd log files,
+// in order. The files may be gzip compressed.
+func NewLogFileSource(paths []string) Source {
+	return &logFileSource{paths: paths}
+}
+
+// LogFileRotations returns the rotations of a log file, audit.log.4 to
+// audit.log.1 then audit.log, oldest first. Compressed rotations such as
+// audit.log.2.gz are included.
+func LogFileRotations(path string) ([]string, error) {
+	matches, err := filepath.Glob(path + ".*")
+	if err != nil {
+		return nil, err
+	}
+
+	type rotation struct {
+		path string
+		n    int
+	}
+
+	var rotations []rotation
+	for _, m := range matches {
+		suffix := strings.TrimSuffix(strings.TrimPrefix(m, path+"."), ".gz")
+		n, err := strconv.Atoi(suffix)
+		if err != nil {
+			continue
+		}
+		rotations = append(rotations, rotation{m, n})
+	}
+
+	sort.Slice(rotations, func(i, j int) bool {
+		return rotations[i].n > rotations[j].n
+	})
+
+	paths := make([]string, 0, len(rotations)+1)
+	for _, r := range rotations {
+		paths = append(paths, r.path)
+	}
+
+	if _, err := os.Stat(path); err == nil {
+		paths = append(paths, path)
+	}
+
+	return paths, nil
+}
+
+// logFileSource reads the audit records from log files
+type logFileSource struct {
+	mu     sync.Mutex
+	paths  []string
+	file   *os.File
+	name   string
+	line   int
+	lines  *bufio.Reader
+	closed bool
+}
+
+// Next returns the next record of the log files, io.EOF after the last one
+func (l *logFileSource) Next() (*AuditMessage, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for !l.closed {
+		if l.lines == nil {
+			if len(l.paths) == 0 {
+				l.closed = true
+				break
+			}
+
+			if err := l.open(l.paths[0]); err != nil {
+				l.paths = l.paths[1:]
+				return nil, err
+			}
+			l.paths = l.paths[1:]
+		}
+
+		line, err := l.lines.ReadSlice('\n')
+		if err == bufio.ErrBufferFull {
+			// Throw away the rest of an over-long line and keep reading
+			for err == bufio.ErrBufferFull {
+				_, err = l.lines.ReadSlice('\n')
+			}
+
+			if err == nil || err == io.EOF {
+				l.line++
+				return nil, fmt.Errorf("%s:%d: %w", l.name, l.line, ErrLineTooLong)
+			}
+		}
+
+		if err != nil && (err != io.EOF || len(line) == 0) {
+			l.file.Close()
+			l.lines = nil
+			if err != io.EOF {
+				return nil, fmt.Errorf("%s: %s", l.name, err)
+			}
+			continue
+		}
+
+		l.line++
+		line = bytes.TrimSuffix(bytes.TrimSuffix(line, []byte{'\n'}), []byte{'\r'})
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+
+		msg, err := parseLogRecord(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %s", l.name, l.line, err)
+		}
+		return msg, nil
+	}
+
+	return nil, io.EOF
+}
+
+func (l *logFileSource) open(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+
+	var r io.Reader = bufio.NewReader(f)
+	if magic, _ := r.(*bufio.Reader).Peek(2); bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		if r, err = gzip.NewReader(r); err != nil {
+			f.Close()
+			return fmt.Errorf("%s: %s", path, err)
+		}
+	}
+
+	l.file, l.name, l.line = f, path, 0
+	l.lines = bufio.NewReaderSize(r, MAX_LOG_LINE_LENGTH)
+	return nil
+}
+
+// Close stops the replay, Next returns io.EOF from now on
+func (l *logFileSource) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.lines != nil {
+		l.file.Close()
+		l.lines = nil
+	}
+	l.closed = true
+	return nil
+}
+
+// parseLogRecord parses a log line like
+//
+//	type=SYSCALL msg=audit(1621634984.633:49129): arch=c000003e ...
+//
+// A node= prefix and the fields added by the ENRICHED log format are ignored.
+func parseLogRecord(line []byte) (*AuditMessage, error) {
+	if i := bytes.IndexByte(line, enrichedSeparator); i >= 0 {
+		line = line[:i]
+	}
+
+	typeStart := bytes.Index(line, []byte("type="))
+	if typeStart < 0 || (typeStart > 0 && line[typeStart-1] != ' ') {
+		return nil, errors.New("Missing record type")
+	}
+	rest := line[typeStart+len("type="):]
+
+	typeEnd := bytes.IndexByte(rest, ' ')
+	if typeEnd < 0 {
+		return nil, errors.New("Missing record message")
+	}
+
+	name := string(rest[:typeEnd])
+	t, ok := RecordTypeByName(name)
+	if !ok {
+		return nil, fmt.Errorf("Unknown record type %s", name)
+	}
+
+	rest = bytes.TrimLeft(rest[typeEnd:], " ")
+	if !bytes.HasPrefix(rest, []byte("msg=audit(")) {
+		return nil, errors.New("Missing record header")
+	}
+
+	return newRecordMessage(t, rest[len("msg="):]), nil
+}
@@ -0,0 +1,162 @@
+package auditrd
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testLog = `type=SYSCALL msg=audit(1621634984.633:49129): arch=c000003e syscall=59 success=yes exit=0 a0=5568f3453f40 a1=5568f34456a0 a2=5568f33115f0 a3=8 items=2 ppid=245843 pid=262165 auid=1000 uid=0 gid=0 euid=0 suid=0 fsuid=0 egid=0 sgid=0 fsgid=0 tty=pts3 ses=166 comm="auditctl" exe="/usr/sbin/auditctl" key=(null)` + "\x1d" + `ARCH=x86_64 SYSCALL=execve
+type=EXECVE msg=audit(1621634984.633:49129): argc=2 a0="auditctl" a1="-l"
+node=host type=CWD msg=audit(1621634984.633:49129): cwd="/etc"
+
+type=EOE msg=audit(1621634984.633:49129): 
+type=USER_CMD msg=audit(1621634985.001:49130): pid=1 uid=0 msg='cwd="/" cmd="ls" res=success'
+`
+
+func TestParseLogRecord(t *testing.T) {
+	msg, err := parseLogRecord([]byte(`node=host type=UNKNOWN[1999] msg=audit(1621634985.001:49130): a=b`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if msg.Type != 1999 || msg.Seq != 49130 || msg.AuditTime != "1621634985.001" ||
+		msg.Data != "a=b" {
+		t.Errorf("Unexpected record %+v", msg)
+	}
+
+	for _, line := range []string{
+		`type=BOGUS msg=audit(1621634985.001:49130): a=b`,
+		`subtype=SYSCALL msg=audit(1621634985.001:49130): a=b`,
+		`type=SYSCALL audit(1621634985.001:49130): a=b`,
+	} {
+		if _, err := parseLogRecord([]byte(line)); err == nil {
+			t.Errorf("Expected an error for %q", line)
+		}
+	}
+}
+
+func TestLogFileRotations(t *testing.T) {
+	dir := t.TempDir()
+	log := filepath.Join(dir, "audit.log")
+	for _, name := range []string{"audit.log", "audit.log.1", "audit.log.2.gz", "audit.log.10", "audit.log.bak"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	paths, err := LogFileRotations(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{log + ".10", log + ".2.gz", log + ".1", log}
+	if !reflect.DeepEqual(paths, expected) {
+		t.Errorf("Expected %v, got %v", expected, paths)
+	}
+}
+
+func TestLogFileReader(t *testing.T) {
+	dir := t.TempDir()
+
+	// The rotated file is compressed
+	rotated := filepath.Join(dir, "audit.log.1")
+	f, err := os.Create(rotated)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gz := gzip.NewWriter(f)
+	gz.Write([]byte(testLog))
+	gz.Close()
+	f.Close()
+
+	current := filepath.Join(dir, "audit.log")
+	if err := os.WriteFile(current, []byte("garbage\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	rd, err := NewLogFileReader(context.Background(), []string{rotated, current},
+		WithRecordTypes(RecordTypeRange{Min: 1100, Max: 1399}),
+		WithReassemblyTimeout(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var groups []*AuditMessageGroup
+	for g := range rd.Events() {
+		groups = append(groups, g)
+	}
+
+	if len(groups) != 2 {
+		t.Fatalf("Expected 2 groups, got %d", len(groups))
+	}
+
+	if g := groups[0]; g.Seq != 49129 || len(g.Msgs) != 3 ||
+		!strings.HasSuffix(g.Msgs[0].Data, "key=(null)") ||
+		g.Msgs[2].Type != AUDIT_CWD {
+		t.Errorf("Unexpected syscall group %+v", g)
+	}
+
+	// The user event has no EOE, it's flushed at the end of the files
+	if g := groups[1]; g.Seq != 49130 || g.AuditTime != "1621634985.001" {
+		t.Errorf("Unexpected user group %+v", g)
+	}
+
+	if err := <-rd.Errors(); err == nil {
+		t.Error("Expected an error for the garbage line")
+	}
+}
+
+func TestLogFileReaderLongLine(t *testing.T) {
+	long := `type=USER_CMD msg=audit(1621634985.001:49130): cmd=` +
+		strings.Repeat("a", MAX_LOG_LINE_LENGTH) + "\n"
+	log := filepath.Join(t.TempDir(), "audit.log")
+	if err := os.WriteFile(log, []byte(testLog+long+testLog), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	source := NewLogFileSource([]string{log})
+	var msgs int
+	var errs []error
+	for {
+		msg, err := source.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if msg != nil {
+			msgs++
+		}
+	}
+
+	// The records after the long line are still read
+	if msgs != 10 {
+		t.Errorf("Expected 10 records, got %d", msgs)
+	}
+
+	if len(errs) != 1 || !errors.Is(errs[0], ErrLineTooLong) || !strings.Contains(errs[0].Error(), ":7:") {
+		t.Errorf("Unexpected errors %v", errs)
+	}
+
+	rd, err := NewLogFileReader(context.Background(), []string{log},
+		WithRecordTypes(RecordTypeRange{Min: 1100, Max: 1399}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range rd.Events() {
+	}
+
+	if n := rd.Stats().LinesTooLong; n != 1 {
+		t.Errorf("Expected 1 line too long, got %d", n)
+	}
+}
@@ -3,6 +3,7 @@ package auditrd
 import (
 	"fmt"
 	"os"
+	"sort"
 	"syscall"
 	"time"
 
@@ -14,17 +15,24 @@ const (
 )
 
 type auditMarshaller struct {
-	writer            chan *AuditMessageGroup
-	msgs              map[int]*AuditMessageGroup
-	lastSeq           int
-	missed            map[int]bool
-	worstLag          int
-	minAuditEventType uint16
-	maxAuditEventType uint16
-	trackMessages     bool
-	logOutOfOrder     bool
-	maxOutOfOrder     int
-	attempts          int
+	writer        chan *AuditMessageGroup
+	msgs          map[uint64]*AuditMessageGroup
+	lastSeq       uint64
+	missed        map[uint64]bool
+	worstLag      uint64
+	recordTypes   []RecordTypeRange
+	completeAfter time.Duration
+	trackMessages bool
+	logOutOfOrder bool
+	maxOutOfOrder int
+	attempts      int
+	stats         *readerStats
+	backpressure  BackpressurePolicy
+	spill         *spillQueue
+
+	// done unblocks the writes to the writer channel when closed, a nil
+	// channel waits for the reader forever.
+	done <-chan struct{}
 }
 
 // Create a new marshaller
@@ -34,14 +42,17 @@ func NewAuditMarshaller(
 	trackMessages, logOOO bool, maxOOO int,
 ) *auditMarshaller {
 	return &auditMarshaller{
-		writer:            writer,
-		msgs:              make(map[int]*AuditMessageGroup, 5), // It is not typical to have more than 2 message groups at any given time
-		missed:            make(map[int]bool, 10),
-		minAuditEventType: minAuditEventType,
-		maxAuditEventType: maxAuditEventType,
-		trackMessages:     trackMessages,
-		logOutOfOrder:     logOOO,
-		maxOutOfOrder:     maxOOO,
+		writer: writer,
+		msgs:   make(map[uint64]*AuditMessageGroup, 5), // It is not typical to have more than 2 message groups at any given time
+		missed: make(map[uint64]bool, 10),
+		recordTypes: []RecordTypeRange{
+			{Min: minAuditEventType, Max: maxAuditEventType},
+		},
+		completeAfter: COMPLETE_AFTER,
+		trackMessages: trackMessages,
+		logOutOfOrder: logOOO,
+		maxOutOfOrder: maxOOO,
+		stats:         &readerStats{},
 	}
 }
 
@@ -58,7 +69,11 @@ func debug(aMsg *AuditMessage) {
 
 // Ingests a netlink message and likely prepares it to be logged
 func (a *auditMarshaller) Process(nlMsg *syscall.NetlinkMessage) {
-	aMsg := newAuditMessage(nlMsg)
+	a.ProcessMessage(newAuditMessage(nlMsg))
+}
+
+// ProcessMessage ingests an audit record read from any Source
+func (a *auditMarshaller) ProcessMessage(aMsg *AuditMessage) {
 	if aMsg.Seq == 0 {
 		// We got an invalid audit message, return the current message and reset
 		glog.V(3).Infoln("Got a message with seq id 0, ignoring")
@@ -67,21 +82,25 @@ func (a *auditMarshaller) Process(nlMsg *syscall.NetlinkMessage) {
 	}
 
 	debug(aMsg)
+	a.stats.inc(&a.stats.messagesReceived, a.stats.metrics.MessagesReceived)
 
 	if a.trackMessages {
 		a.detectMissing(aMsg.Seq)
 	}
 
-	if nlMsg.Header.Type < a.minAuditEventType ||
-		nlMsg.Header.Type > a.maxAuditEventType {
-		// Drop all audit messages that aren't things we care about or end a
-		// multi packet event
+	if aMsg.Type == EVENT_EOE {
+		// This is end of event msg, flush the msg with that sequence and
+		// discard this one. It's handled even when the EOE type isn't selected
+		// so that the groups don't wait for the timeout.
+		if _, ok := a.msgs[aMsg.Seq]; ok {
+			a.stats.inc(&a.stats.groupsEnded, a.stats.metrics.GroupsEnded)
+			a.completeMessage(aMsg.Seq)
+		}
 		a.flushOld()
 		return
-	} else if nlMsg.Header.Type == EVENT_EOE {
-		// This is end of event msg, flush the msg with that sequence and
-		// discard this one
-		a.completeMessage(aMsg.Seq)
+	} else if !a.accepts(aMsg.Type) {
+		// Drop all audit messages that aren't things we care about
+		a.flushOld()
 		return
 	}
 
@@ -90,26 +109,52 @@ func (a *auditMarshaller) Process(nlMsg *syscall.NetlinkMessage) {
 		val.addMessage(aMsg)
 	} else {
 		// Create a new AuditMessageGroup
-		a.msgs[aMsg.Seq] = newAuditMessageGroup(aMsg)
+		a.msgs[aMsg.Seq] = newAuditMessageGroup(aMsg, a.completeAfter)
 	}
 
 	a.flushOld()
 	return
 }
 
+// accepts tells if the record type is in one of the selected ranges
+func (a *auditMarshaller) accepts(t uint16) bool {
+	for _, r := range a.recordTypes {
+		if t >= r.Min && t <= r.Max {
+			return true
+		}
+	}
+
+	return false
+}
+
 // Outputs any messages that are old enough
 // This is because there is no indication of multi message events coming from kaudit
 func (a *auditMarshaller) flushOld() {
 	now := time.Now()
 	for seq, msg := range a.msgs {
 		if msg.CompleteAfter.Before(now) || now.Equal(msg.CompleteAfter) {
+			a.stats.inc(&a.stats.groupsTimedOut, a.stats.metrics.GroupsTimedOut)
 			a.completeMessage(seq)
 		}
 	}
 }
 
+// flushAll outputs every pending message, in sequence order, when the input
+// ended
+func (a *auditMarshaller) flushAll() {
+	seqs := make([]uint64, 0, len(a.msgs))
+	for seq := range a.msgs {
+		seqs = append(seqs, seq)
+	}
+	sort.Slice(seqs, func(i, j int) bool { return seqs[i] < seqs[j] })
+
+	for _, seq := range seqs {
+		a.completeMessage(seq)
+	}
+}
+
 // Write a complete message group to the configured output in json format
-func (a *auditMarshaller) completeMessage(seq int) {
+func (a *auditMarshaller) completeMessage(seq uint64) {
 	var msg *AuditMessageGroup
 	var ok bool
 
@@ -119,12 +164,76 @@ func (a *auditMarshaller) completeMessage(seq int) {
 		return
 	}
 
-	a.writer <- msg
 	delete(a.msgs, seq)
+	a.emit(msg)
+}
+
+// emit writes a group to the output, what happens when the output is full
+// depends on the backpressure policy.
+func (a *auditMarshaller) emit(msg *AuditMessageGroup) {
+	if a.spill == nil || a.spill.empty() {
+		// Nothing is spilled, the group can go straight to the output
+		select {
+		case a.writer <- msg:
+			a.stats.inc(&a.stats.groupsEmitted, a.stats.metrics.GroupsEmitted)
+			return
+		default:
+		}
+	}
+
+	switch a.backpressure {
+	case BackpressureDropNewest:
+		a.drop(msg)
+
+	case BackpressureDropOldest:
+		// The channel is the ring buffer, make room by reading from it. The
+		// consumer may read too, in which case nothing needs to be dropped.
+		for {
+			select {
+			case a.writer <- msg:
+				a.stats.inc(&a.stats.groupsEmitted, a.stats.metrics.GroupsEmitted)
+				return
+			default:
+			}
+
+			select {
+			case oldest := <-a.writer:
+				a.drop(oldest)
+			default:
+			}
+		}
+
+	case BackpressureSpill:
+		ok, err := a.spill.push(msg)
+		if err != nil {
+			glog.Error("Failed to spill the message group: ", err)
+		}
+		if !ok {
+			a.drop(msg)
+			return
+		}
+		a.stats.inc(&a.stats.spilled, a.stats.metrics.Spilled)
+
+	default:
+		// Nobody is keeping up with the output, wait for it
+		a.stats.inc(&a.stats.channelFullStalls, a.stats.metrics.ChannelFullStalls)
+		select {
+		case a.writer <- msg:
+			a.stats.inc(&a.stats.groupsEmitted, a.stats.metrics.GroupsEmitted)
+		case <-a.done:
+			glog.V(2).Infof("Reader stopped, dropping message sequence id: %d", msg.Seq)
+		}
+	}
+}
+
+// drop discards a group because the output is full
+func (a *auditMarshaller) drop(msg *AuditMessageGroup) {
+	a.stats.inc(&a.stats.dropped, a.stats.metrics.Dropped)
+	glog.V(2).Infof("Output full, dropping message sequence id: %d", msg.Seq)
 }
 
 // Track sequence numbers and log if we suspect we missed a message
-func (a *auditMarshaller) detectMissing(seq int) {
+func (a *auditMarshaller) detectMissing(seq uint64) {
 	if seq > a.lastSeq+1 && a.lastSeq != 0 {
 		// We likely leap frogged over a msg, wait until the next sequence to
 		// make sure
@@ -135,6 +244,7 @@ func (a *auditMarshaller) detectMissing(seq int) {
 
 	for missedSeq := range a.missed {
 		if missedSeq == seq {
+			a.stats.inc(&a.stats.outOfOrder, a.stats.metrics.OutOfOrder)
 			lag := a.lastSeq - missedSeq
 			if lag > a.worstLag {
 				a.worstLag = lag
@@ -147,7 +257,8 @@ func (a *auditMarshaller) detectMissing(seq int) {
 					"messages. Worst lag so far", a.worstLag, "messages")
 			}
 			delete(a.missed, missedSeq)
-		} else if seq-missedSeq > a.maxOutOfOrder {
+		} else if seq > missedSeq && seq-missedSeq > uint64(a.maxOutOfOrder) {
+			a.stats.inc(&a.stats.sequencesMissed, a.stats.metrics.SequencesMissed)
 			glog.V(2).Infof(
 				"Likely missed sequence %d, current %d, worst message delay %d",
 				missedSeq, seq, a.worstLag)
@@ -145,3 +145,71 @@ func TestProcess(t *testing.T) {
 		t.FailNow()
 	}
 }
+
+func TestProcessRecordTypes(t *testing.T) {
+	w := make(chan *AuditMessageGroup, 10)
+	marshaller := NewAuditMarshaller(w, 0, 0, false, false, 0)
+	marshaller.recordTypes = []RecordTypeRange{
+		{Min: 1300, Max: 1300},
+		{Min: 1307, Max: 1309},
+	}
+
+	p := msg1302(1)
+	marshaller.Process(msg1300())
+	marshaller.Process(msg1309())
+	marshaller.Process(msg1307())
+	marshaller.Process(p[0])
+
+	// The EOE is outside of the selected ranges but still ends the event
+	marshaller.Process(msg1320())
+
+	if len(w) != 1 {
+		t.Fatalf("Expected one message group, got %d", len(w))
+	}
+
+	for _, m := range (<-w).Msgs {
+		if m.Type == AUDIT_PATH {
+			t.Error("PATH records should have been dropped")
+		}
+	}
+}
+
+func groupSeqs(w chan *AuditMessageGroup) []uint64 {
+	close(w)
+	var seqs []uint64
+	for g := range w {
+		seqs = append(seqs, g.Seq)
+	}
+	return seqs
+}
+
+func TestEmitBackpressure(t *testing.T) {
+	tests := []struct {
+		policy  BackpressurePolicy
+		seqs    []uint64
+		dropped uint64
+	}{
+		{BackpressureDropNewest, []uint64{1, 2}, 2},
+		{BackpressureDropOldest, []uint64{3, 4}, 2},
+	}
+
+	for _, test := range tests {
+		w := make(chan *AuditMessageGroup, 2)
+		marshaller := NewAuditMarshaller(w, 1100, 1399, false, false, 0)
+		marshaller.backpressure = test.policy
+
+		for seq := uint64(1); seq <= 4; seq++ {
+			marshaller.emit(&AuditMessageGroup{Seq: seq})
+		}
+
+		if s := marshaller.stats.snapshot(); s.Dropped != test.dropped {
+			t.Errorf("Policy %d: expected %d drops, got %d",
+				test.policy, test.dropped, s.Dropped)
+		}
+
+		seqs := groupSeqs(w)
+		if len(seqs) != 2 || seqs[0] != test.seqs[0] || seqs[1] != test.seqs[1] {
+			t.Errorf("Policy %d: expected %v, got %v", test.policy, test.seqs, seqs)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package auditrd
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// KERNEL_STATUS_INTERVAL is how often the kernel lost counter is polled from a
+// netlink source.
+const KERNEL_STATUS_INTERVAL = time.Second * 10
+
+// Counter is a monotonic counter, a prometheus.Counter satisfies it
+type Counter interface {
+	Add(float64)
+}
+
+// Gauge is a value that can go up and down, a prometheus.Gauge satisfies it
+type Gauge interface {
+	Set(float64)
+}
+
+// Metrics are updated along with the reader Stats so that they can be
+// exported, the nil ones are skipped.
+type Metrics struct {
+	MessagesReceived  Counter
+	GroupsEmitted     Counter
+	GroupsTimedOut    Counter
+	GroupsEnded       Counter
+	SequencesMissed   Counter
+	OutOfOrder        Counter
+	Overruns          Counter
+	ChannelFullStalls Counter
+	Dropped           Counter
+	Spilled           Counter
+	LinesTooLong      Counter
+	KernelLost        Gauge
+}
+
+// Stats is a snapshot of the reader health. A growing SequencesMissed,
+// Overruns or KernelLost means audit events are being lost.
+type Stats struct {
+	// MessagesReceived counts the audit records read from the client
+	MessagesReceived uint64 `json:"messages_received"`
+
+	// GroupsEmitted counts the message groups written to Events
+	GroupsEmitted uint64 `json:"groups_emitted"`
+
+	// GroupsTimedOut and GroupsEnded count the groups completed by the
+	// reassembly timeout and by an EOE record.
+	GroupsTimedOut uint64 `json:"groups_timed_out"`
+	GroupsEnded    uint64 `json:"groups_ended"`
+
+	// SequencesMissed counts the sequences never received within the out of
+	// order window, OutOfOrder the ones received late.
+	SequencesMissed uint64 `json:"sequences_missed"`
+	OutOfOrder      uint64 `json:"out_of_order"`
+
+	// Overruns counts the ENOBUFS errors, the kernel overran the socket
+	Overruns uint64 `json:"overruns"`
+
+	// ChannelFullStalls counts the times the reader waited for Events to be
+	// read.
+	ChannelFullStalls uint64 `json:"channel_full_stalls"`
+
+	// Dropped counts the groups discarded by the backpressure policy, Spilled
+	// the ones queued on disk.
+	Dropped uint64 `json:"dropped"`
+	Spilled uint64 `json:"spilled"`
+
+	// LinesTooLong counts the log file lines skipped for their length
+	LinesTooLong uint64 `json:"lines_too_long"`
+
+	// KernelLost is the lost counter of the kernel audit status as of the last
+	// poll, 0 if the status can't be read.
+	KernelLost uint32 `json:"kernel_lost"`
+}
+
+// readerStats are the counters behind Stats, the 64 bit values come first to
+// keep them aligned for the atomic operations.
+type readerStats struct {
+	messagesReceived  uint64
+	groupsEmitted     uint64
+	groupsTimedOut    uint64
+	groupsEnded       uint64
+	sequencesMissed   uint64
+	outOfOrder        uint64
+	overruns          uint64
+	channelFullStalls uint64
+	dropped           uint64
+	spilled           uint64
+	linesTooLong      uint64
+	kernelLost        uint32
+
+	metrics Metrics
+}
+
+// inc increments a counter and the matching metric
+func (s *readerStats) inc(v *uint64, c Counter) {
+	atomic.AddUint64(v, 1)
+	if c != nil {
+		c.Add(1)
+	}
+}
+
+func (s *readerStats) setKernelLost(lost uint32) {
+	atomic.StoreUint32(&s.kernelLost, lost)
+	if s.metrics.KernelLost != nil {
+		s.metrics.KernelLost.Set(float64(lost))
+	}
+}
+
+func (s *readerStats) snapshot() Stats {
+	return Stats{
+		MessagesReceived:  atomic.LoadUint64(&s.messagesReceived),
+		GroupsEmitted:     atomic.LoadUint64(&s.groupsEmitted),
+		GroupsTimedOut:    atomic.LoadUint64(&s.groupsTimedOut),
+		GroupsEnded:       atomic.LoadUint64(&s.groupsEnded),
+		SequencesMissed:   atomic.LoadUint64(&s.sequencesMissed),
+		OutOfOrder:        atomic.LoadUint64(&s.outOfOrder),
+		Overruns:          atomic.LoadUint64(&s.overruns),
+		ChannelFullStalls: atomic.LoadUint64(&s.channelFullStalls),
+		Dropped:           atomic.LoadUint64(&s.dropped),
+		Spilled:           atomic.LoadUint64(&s.spilled),
+		LinesTooLong:      atomic.LoadUint64(&s.linesTooLong),
+		KernelLost:        atomic.LoadUint32(&s.kernelLost),
+	}
+}
@@ -0,0 +1,229 @@
+package auditrd
+
+import (
+	"fmt"
+	"time"
+)
+
+// Defaults of the audit reader
+const (
+	DEFAULT_BUFFER_SIZE         = 1024
+	DEFAULT_OUT_OF_ORDER_WINDOW = 5
+)
+
+// DEFAULT_RECORD_TYPES are the record types grouped by the reader unless
+// WithRecordTypes is used.
+var DEFAULT_RECORD_TYPES = []RecordTypeRange{{Min: 1100, Max: 1400}}
+
+// BackpressurePolicy tells what the reader does with a complete message group
+// when the Events channel is full.
+type BackpressurePolicy int
+
+const (
+	// BackpressureBlock waits for the consumer, the kernel drops the events
+	// once its backlog is full.
+	BackpressureBlock BackpressurePolicy = iota
+	// BackpressureDropNewest drops the group that doesn't fit
+	BackpressureDropNewest
+	// BackpressureDropOldest drops the oldest group waiting in the channel to
+	// make room for the new one.
+	BackpressureDropOldest
+	// BackpressureSpill queues the groups in a bounded file until the consumer
+	// catches up, the groups that don't fit are dropped.
+	BackpressureSpill
+)
+
+// DEFAULT_SPILL_SIZE bounds the spill file unless WithSpill sets a size
+const DEFAULT_SPILL_SIZE = 64 << 20
+
+// RecordTypeRange selects the record types between Min and Max, both included
+type RecordTypeRange struct {
+	Min uint16
+	Max uint16
+}
+
+// ReaderOption changes the default behavior of the audit reader
+type ReaderOption func(*readerConfig)
+
+type readerConfig struct {
+	multicast         bool
+	client            Client
+	recordTypes       []RecordTypeRange
+	reassemblyTimeout time.Duration
+	outOfOrderWindow  int
+	logOutOfOrder     bool
+	trackMessages     bool
+	bufferSize        int
+	recvSize          int
+	recvCeiling       int
+	backpressure      BackpressurePolicy
+	spillDir          string
+	spillSize         int64
+	metrics           Metrics
+}
+
+func defaultReaderConfig() *readerConfig {
+	return &readerConfig{
+		recordTypes:       DEFAULT_RECORD_TYPES,
+		reassemblyTimeout: COMPLETE_AFTER,
+		outOfOrderWindow:  DEFAULT_OUT_OF_ORDER_WINDOW,
+		trackMessages:     true,
+		bufferSize:        DEFAULT_BUFFER_SIZE,
+		spillSize:         DEFAULT_SPILL_SIZE,
+	}
+}
+
+func (c *readerConfig) validate() error {
+	if len(c.recordTypes) == 0 {
+		return fmt.Errorf("No record types selected")
+	}
+
+	for _, r := range c.recordTypes {
+		if r.Min > r.Max {
+			return fmt.Errorf("Invalid record type range %d-%d", r.Min, r.Max)
+		}
+	}
+
+	if c.reassemblyTimeout <= 0 {
+		return fmt.Errorf("Invalid reassembly timeout %s", c.reassemblyTimeout)
+	}
+
+	if c.outOfOrderWindow < 0 {
+		return fmt.Errorf("Invalid out of order window %d", c.outOfOrderWindow)
+	}
+
+	if c.recvCeiling < 0 {
+		return fmt.Errorf("Invalid receive buffer ceiling %d", c.recvCeiling)
+	}
+
+	if c.backpressure < BackpressureBlock || c.backpressure > BackpressureSpill {
+		return fmt.Errorf("Invalid backpressure policy %d", c.backpressure)
+	}
+
+	if c.backpressure == BackpressureDropOldest && c.bufferSize == 0 {
+		return fmt.Errorf("Dropping the oldest groups needs a buffered channel")
+	}
+
+	if c.spillSize <= 0 {
+		return fmt.Errorf("Invalid spill size %d", c.spillSize)
+	}
+
+	if c.bufferSize < 0 {
+		return fmt.Errorf("Invalid buffer size %d", c.bufferSize)
+	}
+
+	return nil
+}
+
+// WithMulticast makes the reader join the AUDIT_NLGRP_READLOG multicast group
+// instead of registering itself as the audit daemon. This lets auditrd run
+// alongside auditd or another audit consumer. It needs Linux v3.16 or above and
+// CAP_AUDIT_READ.
+func WithMulticast() ReaderOption {
+	return func(c *readerConfig) {
+		c.multicast = true
+	}
+}
+
+// WithClient makes the reader receive from the given client instead of opening
+// a netlink socket. The reader owns the client and closes it on shutdown.
+func WithClient(client Client) ReaderOption {
+	return func(c *readerConfig) {
+		c.client = client
+	}
+}
+
+// WithRecordTypes selects the record types grouped by the reader, the others
+// are dropped. For example the syscall and user records are selected with
+//
+//	WithRecordTypes(
+//	    RecordTypeRange{Min: 1100, Max: 1199},
+//	    RecordTypeRange{Min: 1300, Max: 1399},
+//	    RecordTypeRange{Min: 2100, Max: 2999},
+//	)
+func WithRecordTypes(ranges ...RecordTypeRange) ReaderOption {
+	return func(c *readerConfig) {
+		c.recordTypes = ranges
+	}
+}
+
+// WithReassemblyTimeout sets how long the records of an event are waited for
+// when no EOE record ends it, COMPLETE_AFTER by default.
+func WithReassemblyTimeout(d time.Duration) ReaderOption {
+	return func(c *readerConfig) {
+		c.reassemblyTimeout = d
+	}
+}
+
+// WithOutOfOrderWindow sets how many sequences a missing one is waited for
+// before it's considered lost.
+func WithOutOfOrderWindow(n int) ReaderOption {
+	return func(c *readerConfig) {
+		c.outOfOrderWindow = n
+	}
+}
+
+// WithOutOfOrderLogging logs the sequences arriving out of order at -v=2
+func WithOutOfOrderLogging() ReaderOption {
+	return func(c *readerConfig) {
+		c.logOutOfOrder = true
+	}
+}
+
+// WithSequenceTracking turns the detection of missing and out of order
+// sequences on or off, it's on by default.
+func WithSequenceTracking(enabled bool) ReaderOption {
+	return func(c *readerConfig) {
+		c.trackMessages = enabled
+	}
+}
+
+// WithBufferSize sets the number of message groups buffered in the Events
+// channel, DEFAULT_BUFFER_SIZE by default.
+func WithBufferSize(n int) ReaderOption {
+	return func(c *readerConfig) {
+		c.bufferSize = n
+	}
+}
+
+// WithReceiveBufferSize sets SO_RCVBUF on the netlink socket, the kernel
+// default is kept if it's not set.
+func WithReceiveBufferSize(bytes int) ReaderOption {
+	return func(c *readerConfig) {
+		c.recvSize = bytes
+	}
+}
+
+// WithReceiveBufferCeiling makes the reader double the socket receive buffer
+// each time the kernel overruns it, up to the given size in bytes.
+func WithReceiveBufferCeiling(bytes int) ReaderOption {
+	return func(c *readerConfig) {
+		c.recvCeiling = bytes
+	}
+}
+
+// WithBackpressure selects what happens when the Events channel is full,
+// BackpressureBlock by default.
+func WithBackpressure(policy BackpressurePolicy) ReaderOption {
+	return func(c *readerConfig) {
+		c.backpressure = policy
+	}
+}
+
+// WithSpill selects the BackpressureSpill policy, the groups are queued in a
+// file of at most maxBytes created in dir. The default temporary directory is
+// used if dir is empty.
+func WithSpill(dir string, maxBytes int64) ReaderOption {
+	return func(c *readerConfig) {
+		c.backpressure = BackpressureSpill
+		c.spillDir = dir
+		c.spillSize = maxBytes
+	}
+}
+
+// WithMetrics updates the given counters along with the reader Stats
+func WithMetrics(m Metrics) ReaderOption {
+	return func(c *readerConfig) {
+		c.metrics = m
+	}
+}
@@ -19,14 +19,16 @@ const (
 	COMPLETE_AFTER    = time.Second * 2 // Log a message after this time or EOE
 )
 
-// Creates a new message group from the details parsed from the message
-func newAuditMessageGroup(am *AuditMessage) *AuditMessageGroup {
+// Creates a new message group from the details parsed from the message, the
+// group is complete after the given time unless an EOE comes first.
+func newAuditMessageGroup(am *AuditMessage, completeAfter time.Duration) *AuditMessageGroup {
 	//TODO: allocating 6 msgs per group is lame and we _should_ know ahead of
 	//time roughly how many we need
 	amg := &AuditMessageGroup{
 		Seq:           am.Seq,
+		Timestamp:     am.Timestamp,
 		AuditTime:     am.AuditTime,
-		CompleteAfter: time.Now().Add(COMPLETE_AFTER),
+		CompleteAfter: time.Now().Add(completeAfter),
 		Msgs:          make([]*AuditMessage, 0, 6),
 	}
 
@@ -36,34 +38,82 @@ func newAuditMessageGroup(am *AuditMessage) *AuditMessageGroup {
 
 // Creates a new auditrd message from a netlink message
 func newAuditMessage(nlm *syscall.NetlinkMessage) *AuditMessage {
-	aTime, seq := parseAuditHeader(nlm)
+	return newRecordMessage(nlm.Header.Type, nlm.Data)
+}
+
+// newRecordMessage creates a new auditrd message from a record starting with
+// the audit(time:seq): header, whatever it was read from.
+func newRecordMessage(msgType uint16, data []byte) *AuditMessage {
+	aTime, seq, rest := splitAuditHeader(data)
+	ts, _ := parseAuditTime(aTime)
 	return &AuditMessage{
-		Type:      nlm.Header.Type,
-		Data:      string(nlm.Data),
+		Type:      msgType,
+		Data:      string(rest),
 		Seq:       seq,
 		AuditTime: aTime,
+		Timestamp: ts,
 	}
 }
 
-// Gets the timestamp and audit sequence id from a netlink message
-func parseAuditHeader(msg *syscall.NetlinkMessage) (time string, seq int) {
-	headerStop := bytes.Index(msg.Data, headerEndChar)
+// parseAuditTime parses the seconds.milliseconds time of an audit header
+func parseAuditTime(aTime string) (time.Time, error) {
+	secs, frac := aTime, ""
+	if dot := strings.IndexByte(aTime, '.'); dot >= 0 {
+		secs, frac = aTime[:dot], aTime[dot+1:]
+	}
+
+	sec, err := strconv.ParseInt(secs, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	// The kernel always prints 3 digits, don't assume it
+	var msec int64
+	for i := 0; i < 3; i++ {
+		msec *= 10
+		if i < len(frac) {
+			if frac[i] < '0' || frac[i] > '9' {
+				return time.Time{}, strconv.ErrSyntax
+			}
+			msec += int64(frac[i] - '0')
+		}
+	}
+
+	return time.Unix(sec, msec*int64(time.Millisecond)).UTC(), nil
+}
+
+// splitAuditHeader gets the timestamp and audit sequence id from a record and
+// returns the data following the header, the record is returned as is if it
+// has no header. The sequence id is 0 if the header is invalid.
+func splitAuditHeader(data []byte) (time string, seq uint64, rest []byte) {
+	headerStop := bytes.Index(data, headerEndChar)
 	// If the position the header appears to stop is less than the minimum
 	// length of a header, bail out
 	if headerStop < HEADER_MIN_LENGTH {
-		return
+		return "", 0, data
 	}
 
-	header := string(msg.Data[:headerStop])
+	header := string(data[:headerStop])
 	if header[:HEADER_START_POS] == "audit(" {
-		//TODO: out of range check, possibly fully binary?
 		sep := strings.IndexByte(header, headerSepChar)
+		if sep < HEADER_START_POS {
+			return "", 0, data
+		}
+
+		var err error
+		if seq, err = strconv.ParseUint(header[sep+1:], 10, 64); err != nil {
+			return "", 0, data
+		}
 		time = header[HEADER_START_POS:sep]
-		seq, _ = strconv.Atoi(header[sep+1:])
 
-		// Remove the header from data
-		msg.Data = msg.Data[headerStop+3:]
+		// Remove the header from data, a record without fields may not have
+		// the space following the header
+		start := headerStop + 3
+		if start > len(data) {
+			start = len(data)
+		}
+		data = data[start:]
 	}
 
-	return time, seq
+	return time, seq, data
 }
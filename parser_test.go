@@ -1,6 +1,8 @@
 package auditrd
 
 import (
+	"encoding/json"
+	"strings"
 	"syscall"
 	"testing"
 	"time"
@@ -121,7 +123,7 @@ func TestNewAuditMessageGroup(t *testing.T) {
 		Data:      "Stuff is here",
 	}
 
-	amg := newAuditMessageGroup(m)
+	amg := newAuditMessageGroup(m, COMPLETE_AFTER)
 	if 1019 != amg.Seq {
 		t.FailNow()
 	}
@@ -150,3 +152,68 @@ func TestNewAuditMessageGroup(t *testing.T) {
 		t.FailNow()
 	}
 }
+
+func TestParseAuditTime(t *testing.T) {
+	tests := []struct {
+		in   string
+		want time.Time
+		ok   bool
+	}{
+		{"1621634984.633", time.Unix(1621634984, 633e6), true},
+		{"1621634984.6", time.Unix(1621634984, 600e6), true},
+		{"1621634984", time.Unix(1621634984, 0), true},
+		{"1621634984.6x3", time.Time{}, false},
+		{"", time.Time{}, false},
+	}
+
+	for _, test := range tests {
+		ts, err := parseAuditTime(test.in)
+		if (err == nil) != test.ok || !ts.Equal(test.want) {
+			t.Errorf("%q: expected %v, got %v, %v", test.in, test.want, ts, err)
+		}
+	}
+}
+
+func TestAuditMessageGroupJSON(t *testing.T) {
+	g := &AuditMessageGroup{
+		Seq:       42,
+		AuditTime: "1621634984.633",
+		Timestamp: time.Unix(1621634984, 633e6).UTC(),
+	}
+
+	b, err := json.Marshal(g)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The timestamp key keeps the header time as logged
+	if !strings.Contains(string(b), `"timestamp":"1621634984.633"`) ||
+		!strings.Contains(string(b), `"time":"2021-05-21T22:09:44.633Z"`) {
+		t.Errorf("Unexpected JSON %s", b)
+	}
+}
+
+func TestNewRecordMessageBadHeader(t *testing.T) {
+	am := newRecordMessage(1300, []byte("audit(1621634984.633:x): arch=c000003e"))
+	if am.Seq != 0 || !am.Timestamp.IsZero() {
+		t.Errorf("Expected no sequence and time, got %d %v", am.Seq, am.Timestamp)
+	}
+}
+
+func TestParseAuditMessageGroup(t *testing.T) {
+	g := newAuditMessageGroup(newRecordMessage(1101, []byte(
+		"audit(1621634984.633:49129): pid=10 uid=0 auid=1000 ses=1 msg='op=PAM:accounting acct=\"root\" exe=\"/usr/bin/sudo\" res=success'")), COMPLETE_AFTER)
+
+	ev, ok := ParseAuditMessageGroup(g)
+	if !ok {
+		t.Fatal("Expected a user event")
+	}
+
+	if ev.EventID != 49129 {
+		t.Errorf("Expected event id 49129, got %d", ev.EventID)
+	}
+
+	if !ev.Timestamp.Equal(time.Unix(1621634984, 633e6)) {
+		t.Errorf("Unexpected timestamp %v", ev.Timestamp)
+	}
+}
@@ -1,10 +1,14 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"flag"
 	"os"
+	"os/signal"
+	"syscall"
 
+	"github.com/golang/glog"
 	"github.com/open-osquery/auditrd"
 )
 
@@ -15,20 +19,83 @@ import (
 // at compile-time.
 var Build string
 
+var multicast = flag.Bool("multicast", false,
+	"read from the audit multicast group alongside auditd instead of taking over the audit pid")
+
+var logFile = flag.String("logfile", "",
+	"replay an auditd log file and its rotations instead of reading from the kernel")
+
+var source = flag.String("source", "netlink",
+	"where to read the audit events from: netlink, or stdin when run as an auditd plugin")
+
+var stdinFormat = flag.String("stdin-format", "string",
+	"format auditd sends the events to the plugin in: string or binary")
+
 func main() {
 	flag.Parse()
-	rd, _ := auditrd.NewAuditReader(1100, 1400, 1024, 1024)
-	for msg := range rd {
-		if msg != nil {
-			tokenList := make([]auditrd.AuditMessageTokenMap, 0, 6)
-			for _, d := range msg.Msgs {
-				tokenList = append(tokenList, auditrd.AuditMessageTokenMap{
-					AuditEventType: d.Type,
-					Tokens:         auditrd.Tokenize(d.Data),
-				})
-			}
 
-			ev, ok := auditrd.ParseAuditEvent(tokenList)
+	// The record types the events are parsed from, see auditrd.ParseAuditEvent
+	opts := []auditrd.ReaderOption{auditrd.WithRecordTypes(
+		auditrd.RecordTypeRange{Min: 1100, Max: 1299},
+		auditrd.RecordTypeRange{Min: 1300, Max: 1599},
+		auditrd.RecordTypeRange{Min: 1700, Max: 1899},
+		auditrd.RecordTypeRange{Min: 2100, Max: 2999},
+	)}
+	if *multicast {
+		opts = append(opts, auditrd.WithMulticast())
+	}
+
+	// Stop on SIGINT or SIGTERM so that the audit pid is released
+	ctx, stop := signal.NotifyContext(context.Background(),
+		os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var rd *auditrd.AuditReader
+	var err error
+	switch {
+	case *logFile != "":
+		var paths []string
+		if paths, err = auditrd.LogFileRotations(*logFile); err != nil {
+			glog.Fatal(err)
+		}
+		rd, err = auditrd.NewLogFileReader(ctx, paths, opts...)
+
+	case *source == "stdin":
+		format := auditrd.DispatcherString
+		switch *stdinFormat {
+		case "string":
+		case "binary":
+			format = auditrd.DispatcherBinary
+		default:
+			glog.Fatalf("Unknown stdin format %s", *stdinFormat)
+		}
+		rd, err = auditrd.NewDispatcherReader(ctx, os.Stdin, format, opts...)
+
+	case *source == "netlink":
+		rd, err = auditrd.NewAuditReader(ctx, opts...)
+
+	default:
+		glog.Fatalf("Unknown source %s", *source)
+	}
+	if err != nil {
+		glog.Fatal(err)
+	}
+	defer rd.Close()
+
+	go func() {
+		for err := range rd.Errors() {
+			glog.Error("Failed to read message: ", err)
+		}
+	}()
+
+	for msg := range rd.Events() {
+		if msg != nil && msg.Gap {
+			glog.Warningf("Audit events lost after sequence %d", msg.Seq)
+			continue
+		}
+
+		if msg != nil {
+			ev, ok := auditrd.ParseAuditMessageGroup(msg)
 			if ok {
 				json.NewEncoder(os.Stdout).Encode(ev)
 			}
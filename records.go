@@ -0,0 +1,572 @@
+package auditrd
+
+import (
+	"encoding/hex"
+	"strconv"
+	"strings"
+)
+
+// AuditRecord is a single audit record decoded in a typed struct, see
+// DecodeRecord. Whatever the struct doesn't decode is kept in the raw fields so
+// that no information is lost.
+type AuditRecord interface {
+	// RecordType returns the type of the record, one of the AUDIT_ constants
+	RecordType() uint16
+
+	// RawFields returns all the fields of the record as they were logged
+	RawFields() map[string]string
+}
+
+// RecordFields holds the type and raw fields of a record, the typed records
+// embed it.
+type RecordFields struct {
+	Type   uint16            `json:"type"`
+	Fields map[string]string `json:"fields"`
+}
+
+func (r *RecordFields) RecordType() uint16 {
+	return r.Type
+}
+
+func (r *RecordFields) RawFields() map[string]string {
+	return r.Fields
+}
+
+// str returns a field as logged
+func (r *RecordFields) str(name string) string {
+	return r.Fields[name]
+}
+
+// untrusted returns a string field logged by audit_log_untrustedstring, which
+// is either quoted or hex encoded. (null) and ? are returned as is.
+func (r *RecordFields) untrusted(name string) string {
+	return decodeUntrusted(r.Fields[name])
+}
+
+// int returns a decimal field, 0 if it's missing or invalid
+func (r *RecordFields) int(name string) int {
+	v, _ := strconv.Atoi(r.Fields[name])
+	return v
+}
+
+// hex returns a hexadecimal field, with or without the 0x prefix
+func (r *RecordFields) hex(name string) uint64 {
+	v, _ := strconv.ParseUint(strings.TrimPrefix(r.Fields[name], "0x"), 16, 64)
+	return v
+}
+
+// mode returns an octal field like a file mode, 0 if it's missing or invalid
+func (r *RecordFields) mode(name string) uint32 {
+	v, _ := strconv.ParseUint(r.Fields[name], 8, 32)
+	return uint32(v)
+}
+
+func decodeUntrusted(v string) string {
+	if len(v) >= 2 && v[0] == '"' && v[len(v)-1] == '"' {
+		return v[1 : len(v)-1]
+	}
+
+	if b, err := hex.DecodeString(v); err == nil && len(v) > 0 {
+		return string(b)
+	}
+
+	return v
+}
+
+// GenericRecord is a record without a typed decoder, only its raw fields are
+// available.
+type GenericRecord struct {
+	RecordFields
+}
+
+// SockaddrRecord is the AUDIT_SOCKADDR record, the socket address passed to a
+// syscall.
+type SockaddrRecord struct {
+	RecordFields
+	Saddr []byte    `json:"saddr"`
+	Addr  *Sockaddr `json:"addr,omitempty"`
+}
+
+// ExecveRecord is the AUDIT_EXECVE record, the arguments of an execve. Args
+// holds the arguments of the record, decoded, the ones split across several
+// records are only complete in the AuditEvent Argv.
+type ExecveRecord struct {
+	RecordFields
+	Argc int      `json:"argc"`
+	Args []string `json:"args"`
+}
+
+// FdPairRecord is the AUDIT_FD_PAIR record, the descriptors created by pipe
+// or socketpair.
+type FdPairRecord struct {
+	RecordFields
+	Fd0 int `json:"fd0"`
+	Fd1 int `json:"fd1"`
+}
+
+// ObjPidRecord is the AUDIT_OBJ_PID record, the target of a ptrace or a signal
+type ObjPidRecord struct {
+	RecordFields
+	Pid     int    `json:"pid"`
+	Auid    int    `json:"auid"`
+	Uid     int    `json:"uid"`
+	Ses     int    `json:"ses"`
+	Context string `json:"context,omitempty"`
+	Comm    string `json:"comm"`
+}
+
+// BprmFcapsRecord is the AUDIT_BPRM_FCAPS record, the file capabilities which
+// raised the capabilities of an executed program.
+type BprmFcapsRecord struct {
+	RecordFields
+	FileVersion     int           `json:"fver"`
+	FilePermitted   CapabilitySet `json:"fp"`
+	FileInheritable CapabilitySet `json:"fi"`
+	FileEffective   bool          `json:"fe"`
+	OldPermitted    CapabilitySet `json:"old_pp"`
+	OldInheritable  CapabilitySet `json:"old_pi"`
+	OldEffective    CapabilitySet `json:"old_pe"`
+	OldAmbient      CapabilitySet `json:"old_pa"`
+	Permitted       CapabilitySet `json:"pp"`
+	Inheritable     CapabilitySet `json:"pi"`
+	Effective       CapabilitySet `json:"pe"`
+	Ambient         CapabilitySet `json:"pa"`
+}
+
+// CapsetRecord is the AUDIT_CAPSET record, the arguments of capset
+type CapsetRecord struct {
+	RecordFields
+	Pid         int           `json:"pid"`
+	Inheritable CapabilitySet `json:"cap_pi"`
+	Permitted   CapabilitySet `json:"cap_pp"`
+	Effective   CapabilitySet `json:"cap_pe"`
+	Ambient     CapabilitySet `json:"cap_pa"`
+}
+
+// MmapRecord is the AUDIT_MMAP record, the descriptor and flags of an mmap
+type MmapRecord struct {
+	RecordFields
+	Fd    int    `json:"fd"`
+	Flags uint64 `json:"flags"`
+}
+
+// SeccompRecord is the AUDIT_SECCOMP record, a syscall filtered by seccomp
+type SeccompRecord struct {
+	RecordFields
+	Pid     int    `json:"pid"`
+	Auid    int    `json:"auid"`
+	Uid     int    `json:"uid"`
+	Gid     int    `json:"gid"`
+	Ses     int    `json:"ses"`
+	Comm    string `json:"comm"`
+	Exe     string `json:"exe"`
+	Sig     int    `json:"sig"`
+	Arch    string `json:"arch"`
+	Syscall int    `json:"syscall"`
+	Compat  int    `json:"compat"`
+	IP      uint64 `json:"ip"`
+	Code    uint64 `json:"code"`
+}
+
+// Action returns the seccomp action of the record code, see SeccompAction
+func (r *SeccompRecord) Action() string {
+	return SeccompAction(r.Code)
+}
+
+// KernModuleRecord is the AUDIT_KERN_MODULE record, the name of a module
+// being loaded.
+type KernModuleRecord struct {
+	RecordFields
+	Name string `json:"name"`
+}
+
+// BpfRecord is the AUDIT_BPF record, a BPF program being loaded or unloaded
+type BpfRecord struct {
+	RecordFields
+	ProgID int    `json:"prog_id"`
+	Op     string `json:"op"`
+}
+
+// NetfilterCfgRecord is the AUDIT_NETFILTER_CFG record, a netfilter table
+// being changed.
+type NetfilterCfgRecord struct {
+	RecordFields
+	Table   string `json:"table"`
+	Family  int    `json:"family"`
+	Entries int    `json:"entries"`
+	Op      string `json:"op,omitempty"`
+	Pid     int    `json:"pid,omitempty"`
+	Comm    string `json:"comm,omitempty"`
+}
+
+// AnomalyRecord is one of the AUDIT_ANOM_* kernel records. The fields depend
+// on the type: Dev and the promiscuous flags for ANOM_PROMISCUOUS, Sig for
+// ANOM_ABEND, Op for ANOM_LINK and ANOM_CREAT.
+type AnomalyRecord struct {
+	RecordFields
+	Op      string `json:"op,omitempty"`
+	Dev     string `json:"dev,omitempty"`
+	Prom    int    `json:"prom,omitempty"`
+	OldProm int    `json:"old_prom,omitempty"`
+	Pid     int    `json:"pid,omitempty"`
+	Auid    int    `json:"auid"`
+	Uid     int    `json:"uid"`
+	Gid     int    `json:"gid"`
+	Ses     int    `json:"ses"`
+	Comm    string `json:"comm,omitempty"`
+	Exe     string `json:"exe,omitempty"`
+	Sig     int    `json:"sig,omitempty"`
+	Res     int    `json:"res"`
+}
+
+// AvcRecord is the AUDIT_AVC record, a SELinux or AppArmor access decision,
+// or one of the AUDIT_APPARMOR_* records. For SELinux Result is denied or
+// granted and Permissions the permissions checked, they are available as the
+// seresult and seperms fields too. For AppArmor Result is the apparmor field,
+// lower cased, Permissions the denied or else requested mask, and Name the
+// object of the operation.
+type AvcRecord struct {
+	RecordFields
+	Result        string   `json:"result"`
+	Permissions   []string `json:"permissions"`
+	Pid           int      `json:"pid,omitempty"`
+	Comm          string   `json:"comm,omitempty"`
+	Name          string   `json:"name,omitempty"`
+	SourceContext string   `json:"scontext,omitempty"`
+	TargetContext string   `json:"tcontext,omitempty"`
+	Class         string   `json:"tclass,omitempty"`
+	Permissive    bool     `json:"permissive"`
+	Profile       string   `json:"profile,omitempty"`
+	Operation     string   `json:"operation,omitempty"`
+}
+
+// IntegrityRecord is one of the AUDIT_INTEGRITY_* records, logged by IMA and
+// EVM. File is the name or file field depending on the record.
+type IntegrityRecord struct {
+	RecordFields
+	Op    string `json:"op,omitempty"`
+	Cause string `json:"cause,omitempty"`
+	File  string `json:"file,omitempty"`
+	Hash  string `json:"hash,omitempty"`
+	Pid   int    `json:"pid,omitempty"`
+	Auid  int    `json:"auid"`
+	Uid   int    `json:"uid"`
+	Ses   int    `json:"ses"`
+	Comm  string `json:"comm,omitempty"`
+	Res   int    `json:"res"`
+}
+
+// ConfigChangeRecord is the AUDIT_CONFIG_CHANGE record, a change of the audit
+// rules or settings, or the AUDIT_FEATURE_CHANGE record. Setting is the name
+// of the setting or feature changed, like audit_enabled, from OldValue to
+// Value.
+type ConfigChangeRecord struct {
+	RecordFields
+	Op       string `json:"op,omitempty"`
+	Key      string `json:"key,omitempty"`
+	List     int    `json:"list,omitempty"`
+	Setting  string `json:"setting,omitempty"`
+	Value    string `json:"value,omitempty"`
+	OldValue string `json:"old_value,omitempty"`
+	Pid      int    `json:"pid,omitempty"`
+	Auid     int    `json:"auid"`
+	Ses      int    `json:"ses"`
+	Res      int    `json:"res"`
+}
+
+// recordDecoders decode the records of a type from their raw fields, the
+// types missing here are decoded as GenericRecord.
+var recordDecoders = map[uint16]func(RecordFields) AuditRecord{
+	AUDIT_SOCKADDR:       decodeSockaddr,
+	AUDIT_EXECVE:         decodeExecve,
+	AUDIT_FD_PAIR:        decodeFdPair,
+	AUDIT_OBJ_PID:        decodeObjPid,
+	AUDIT_BPRM_FCAPS:     decodeBprmFcaps,
+	AUDIT_CAPSET:         decodeCapset,
+	AUDIT_MMAP:           decodeMmap,
+	AUDIT_SECCOMP:        decodeSeccomp,
+	AUDIT_KERN_MODULE:    decodeKernModule,
+	AUDIT_BPF:            decodeBpf,
+	AUDIT_NETFILTER_CFG:  decodeNetfilterCfg,
+	AUDIT_AVC:            decodeAvc,
+	AUDIT_CONFIG_CHANGE:  decodeConfigChange,
+	AUDIT_FEATURE_CHANGE: decodeConfigChange,
+	AUDIT_IPC:            decodeIpc,
+	AUDIT_IPC_SET_PERM:   decodeIpc,
+	AUDIT_MQ_OPEN:        decodeMqOpen,
+	AUDIT_MQ_SENDRECV:    decodeMqSendRecv,
+	AUDIT_MQ_NOTIFY:      decodeMqNotify,
+	AUDIT_MQ_GETSETATTR:  decodeMqGetSetAttr,
+}
+
+// DecodeRecord decodes an audit message in the typed record of its type, or a
+// GenericRecord if there is none.
+func DecodeRecord(am *AuditMessage) AuditRecord {
+	r := RecordFields{Type: am.Type, Fields: tokenizeRecord(am.Type, am.Data)}
+
+	decode, ok := recordDecoders[am.Type]
+	switch {
+	case ok:
+	case am.Type >= AUDIT_FIRST_APPARMOR && am.Type <= AUDIT_LAST_APPARMOR:
+		decode = decodeAvc
+	case am.Type >= AUDIT_FIRST_KERN_ANOM_MSG && am.Type <= AUDIT_LAST_KERN_ANOM_MSG:
+		decode = decodeAnomaly
+	case am.Type >= AUDIT_INTEGRITY_DATA && am.Type <= AUDIT_INTEGRITY_POLICY_RULE:
+		decode = decodeIntegrity
+	default:
+		return &GenericRecord{r}
+	}
+
+	return decode(r)
+}
+
+// DecodeRecords decodes all the messages of a group, see DecodeRecord
+func DecodeRecords(msg *AuditMessageGroup) []AuditRecord {
+	records := make([]AuditRecord, 0, len(msg.Msgs))
+	for _, am := range msg.Msgs {
+		records = append(records, DecodeRecord(am))
+	}
+	return records
+}
+
+func decodeSockaddr(r RecordFields) AuditRecord {
+	saddr, _ := hex.DecodeString(r.str("saddr"))
+	addr, _ := ParseSockaddr(saddr)
+	return &SockaddrRecord{RecordFields: r, Saddr: saddr, Addr: addr}
+}
+
+func decodeExecve(r RecordFields) AuditRecord {
+	args := newExecveArgs()
+	args.add(r.Fields)
+	return &ExecveRecord{RecordFields: r, Argc: r.int("argc"), Args: args.argv()}
+}
+
+func decodeFdPair(r RecordFields) AuditRecord {
+	return &FdPairRecord{RecordFields: r, Fd0: r.int("fd0"), Fd1: r.int("fd1")}
+}
+
+func decodeObjPid(r RecordFields) AuditRecord {
+	return &ObjPidRecord{
+		RecordFields: r,
+		Pid:          r.int("opid"),
+		Auid:         r.int("oauid"),
+		Uid:          r.int("ouid"),
+		Ses:          r.int("oses"),
+		Context:      r.str("obj"),
+		Comm:         r.untrusted("ocomm"),
+	}
+}
+
+func decodeBprmFcaps(r RecordFields) AuditRecord {
+	return &BprmFcapsRecord{
+		RecordFields:    r,
+		FileVersion:     r.int("fver"),
+		FilePermitted:   CapabilitySet(r.hex("fp")),
+		FileInheritable: CapabilitySet(r.hex("fi")),
+		FileEffective:   r.str("fe") == "1",
+		OldPermitted:    CapabilitySet(r.hex("old_pp")),
+		OldInheritable:  CapabilitySet(r.hex("old_pi")),
+		OldEffective:    CapabilitySet(r.hex("old_pe")),
+		OldAmbient:      CapabilitySet(r.hex("old_pa")),
+		Permitted:       CapabilitySet(r.hex("pp")),
+		Inheritable:     CapabilitySet(r.hex("pi")),
+		Effective:       CapabilitySet(r.hex("pe")),
+		Ambient:         CapabilitySet(r.hex("pa")),
+	}
+}
+
+func decodeCapset(r RecordFields) AuditRecord {
+	return &CapsetRecord{
+		RecordFields: r,
+		Pid:          r.int("pid"),
+		Inheritable:  CapabilitySet(r.hex("cap_pi")),
+		Permitted:    CapabilitySet(r.hex("cap_pp")),
+		Effective:    CapabilitySet(r.hex("cap_pe")),
+		Ambient:      CapabilitySet(r.hex("cap_pa")),
+	}
+}
+
+func decodeMmap(r RecordFields) AuditRecord {
+	return &MmapRecord{RecordFields: r, Fd: r.int("fd"), Flags: r.hex("flags")}
+}
+
+func decodeSeccomp(r RecordFields) AuditRecord {
+	return &SeccompRecord{
+		RecordFields: r,
+		Pid:          r.int("pid"),
+		Auid:         r.int("auid"),
+		Uid:          r.int("uid"),
+		Gid:          r.int("gid"),
+		Ses:          r.int("ses"),
+		Comm:         r.untrusted("comm"),
+		Exe:          r.untrusted("exe"),
+		Sig:          r.int("sig"),
+		Arch:         r.str("arch"),
+		Syscall:      r.int("syscall"),
+		Compat:       r.int("compat"),
+		IP:           r.hex("ip"),
+		Code:         r.hex("code"),
+	}
+}
+
+func decodeKernModule(r RecordFields) AuditRecord {
+	return &KernModuleRecord{RecordFields: r, Name: r.untrusted("name")}
+}
+
+func decodeBpf(r RecordFields) AuditRecord {
+	return &BpfRecord{RecordFields: r, ProgID: r.int("prog-id"), Op: r.str("op")}
+}
+
+func decodeNetfilterCfg(r RecordFields) AuditRecord {
+	return &NetfilterCfgRecord{
+		RecordFields: r,
+		Table:        r.str("table"),
+		Family:       r.int("family"),
+		Entries:      r.int("entries"),
+		Op:           r.str("op"),
+		Pid:          r.int("pid"),
+		Comm:         r.untrusted("comm"),
+	}
+}
+
+func decodeAnomaly(r RecordFields) AuditRecord {
+	return &AnomalyRecord{
+		RecordFields: r,
+		Op:           r.str("op"),
+		Dev:          r.str("dev"),
+		Prom:         r.int("prom"),
+		OldProm:      r.int("old_prom"),
+		Pid:          r.int("pid"),
+		Auid:         r.int("auid"),
+		Uid:          r.int("uid"),
+		Gid:          r.int("gid"),
+		Ses:          r.int("ses"),
+		Comm:         r.untrusted("comm"),
+		Exe:          r.untrusted("exe"),
+		Sig:          r.int("sig"),
+		Res:          r.int("res"),
+	}
+}
+
+func decodeAvc(r RecordFields) AuditRecord {
+	rec := &AvcRecord{
+		RecordFields:  r,
+		Result:        r.str("seresult"),
+		Permissions:   strings.Fields(r.str("seperms")),
+		Pid:           r.int("pid"),
+		Comm:          r.untrusted("comm"),
+		Name:          r.untrusted("name"),
+		SourceContext: r.str("scontext"),
+		TargetContext: r.str("tcontext"),
+		Class:         r.str("tclass"),
+		Permissive:    r.str("permissive") == "1",
+	}
+
+	if apparmor, ok := r.Fields["apparmor"]; ok {
+		mask := r.untrusted("denied_mask")
+		if mask == "" {
+			mask = r.untrusted("requested_mask")
+		}
+
+		rec.Result = strings.ToLower(decodeUntrusted(apparmor))
+		rec.Permissions = strings.Fields(mask)
+		rec.Profile = r.untrusted("profile")
+		rec.Operation = r.untrusted("operation")
+		rec.Class = r.untrusted("class")
+	}
+
+	return rec
+}
+
+// tokenizeRecord tokenizes the data of a record, see Tokenize, tokenizeAvc and
+// tokenizeUserRecord
+func tokenizeRecord(msgType uint16, data string) map[string]string {
+	if msgType == AUDIT_AVC {
+		return tokenizeAvc(data)
+	}
+	if IsUserEvent(msgType) {
+		return tokenizeUserRecord(data)
+	}
+	return Tokenize(data)
+}
+
+// tokenizeAvc tokenizes an avc record like
+//
+//	avc:  denied  { read write } for  pid=1 comm="x" ...
+//
+// The result and permissions don't fit Tokenize, they are returned as the
+// seresult and seperms fields like auparse does.
+func tokenizeAvc(data string) map[string]string {
+	open, end := strings.IndexByte(data, '{'), strings.IndexByte(data, '}')
+	if !strings.HasPrefix(data, "avc:") || open < 0 || end < open {
+		return Tokenize(data)
+	}
+
+	fields := Tokenize(strings.TrimPrefix(strings.TrimSpace(data[end+1:]), "for "))
+	fields["seresult"] = strings.TrimSpace(data[len("avc:"):open])
+	fields["seperms"] = strings.Join(strings.Fields(data[open+1:end]), " ")
+	return fields
+}
+
+func decodeIntegrity(r RecordFields) AuditRecord {
+	file := r.untrusted("name")
+	if file == "" {
+		file = r.untrusted("file")
+	}
+
+	return &IntegrityRecord{
+		RecordFields: r,
+		Op:           r.str("op"),
+		Cause:        r.str("cause"),
+		File:         file,
+		Hash:         r.untrusted("hash"),
+		Pid:          r.int("pid"),
+		Auid:         r.int("auid"),
+		Uid:          r.int("uid"),
+		Ses:          r.int("ses"),
+		Comm:         r.untrusted("comm"),
+		Res:          r.int("res"),
+	}
+}
+
+// configSettings are the settings logged by CONFIG_CHANGE as name=new old=old
+var configSettings = []string{
+	"audit_enabled",
+	"audit_failure",
+	"audit_pid",
+	"audit_rate_limit",
+	"audit_backlog_limit",
+	"audit_backlog_wait_time",
+}
+
+func decodeConfigChange(r RecordFields) AuditRecord {
+	rec := &ConfigChangeRecord{
+		RecordFields: r,
+		Op:           strings.Trim(r.str("op"), `"`),
+		Key:          r.untrusted("key"),
+		List:         r.int("list"),
+		Pid:          r.int("pid"),
+		Auid:         r.int("auid"),
+		Ses:          r.int("ses"),
+		Res:          r.int("res"),
+	}
+
+	if r.Type == AUDIT_FEATURE_CHANGE {
+		rec.Setting, rec.Value, rec.OldValue = r.str("feature"), r.str("new"), r.str("old")
+		return rec
+	}
+
+	for _, setting := range configSettings {
+		if v, ok := r.Fields[setting]; ok {
+			rec.Setting, rec.Value, rec.OldValue = setting, v, r.str("old")
+			break
+		}
+	}
+
+	// Older kernels don't log op=set
+	if rec.Op == "" && rec.Setting != "" {
+		rec.Op = "set"
+	}
+
+	return rec
+}
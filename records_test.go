@@ -0,0 +1,127 @@
+package auditrd
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDecodeRecord(t *testing.T) {
+	tests := []struct {
+		msgType uint16
+		data    string
+		want    AuditRecord
+	}{
+		{
+			AUDIT_SOCKADDR,
+			`saddr=02000050C0A800010000000000000000`,
+			&SockaddrRecord{Saddr: []byte{2, 0, 0, 0x50, 192, 168, 0, 1, 0, 0, 0, 0, 0, 0, 0, 0},
+				Addr: &Sockaddr{Family: "inet", Address: "192.168.0.1", Port: 80}},
+		},
+		{
+			AUDIT_EXECVE,
+			`argc=3 a0="ls" a1="-l" a2=2F746D702F6120622063`,
+			&ExecveRecord{Argc: 3, Args: []string{"ls", "-l", "/tmp/a b c"}},
+		},
+		{
+			AUDIT_OBJ_PID,
+			`opid=1234 oauid=1000 ouid=0 oses=3 obj=unconfined ocomm="sshd"`,
+			&ObjPidRecord{Pid: 1234, Auid: 1000, Ses: 3, Context: "unconfined", Comm: "sshd"},
+		},
+		{
+			AUDIT_CAPSET,
+			`pid=42 cap_pi=0 cap_pp=3fffffffff cap_pe=3fffffffff cap_pa=0`,
+			&CapsetRecord{Pid: 42, Permitted: 0x3fffffffff, Effective: 0x3fffffffff},
+		},
+		{
+			AUDIT_SECCOMP,
+			`auid=1000 uid=1000 gid=1000 ses=2 pid=77 comm="curl" exe="/usr/bin/curl" sig=31 arch=c000003e syscall=41 compat=0 ip=0x7f3a code=0x0`,
+			&SeccompRecord{Pid: 77, Auid: 1000, Uid: 1000, Gid: 1000, Ses: 2, Comm: "curl",
+				Exe: "/usr/bin/curl", Sig: 31, Arch: "c000003e", Syscall: 41, IP: 0x7f3a},
+		},
+		{
+			AUDIT_BPF,
+			`prog-id=75 op=LOAD`,
+			&BpfRecord{ProgID: 75, Op: "LOAD"},
+		},
+		{
+			AUDIT_AVC,
+			`avc:  denied  { read write } for  pid=1 comm="cat" name="shadow" scontext=u:r:a tcontext=u:r:b tclass=file permissive=0`,
+			&AvcRecord{Result: "denied", Permissions: []string{"read", "write"}, Pid: 1, Comm: "cat",
+				Name: "shadow", SourceContext: "u:r:a", TargetContext: "u:r:b", Class: "file"},
+		},
+		{
+			AUDIT_APPARMOR_DENIED,
+			`apparmor="DENIED" operation="exec" profile="/usr/bin/evince" name="/bin/sh" pid=3 comm="evince" requested_mask="x" denied_mask="x" fsuid=1000 ouid=0`,
+			&AvcRecord{Result: "denied", Permissions: []string{"x"}, Pid: 3, Comm: "evince", Name: "/bin/sh",
+				Profile: "/usr/bin/evince", Operation: "exec"},
+		},
+		{
+			AUDIT_ANOM_ABEND,
+			`auid=1000 uid=1000 gid=1000 ses=2 pid=9 comm="a.out" exe="/tmp/a.out" sig=11 res=1`,
+			&AnomalyRecord{Pid: 9, Auid: 1000, Uid: 1000, Gid: 1000, Ses: 2, Comm: "a.out",
+				Exe: "/tmp/a.out", Sig: 11, Res: 1},
+		},
+		{
+			AUDIT_INTEGRITY_RULE,
+			`file="/usr/bin/x" hash="sha256:abcd" ppid=1 pid=5 auid=0 uid=0 ses=1 comm="sh"`,
+			&IntegrityRecord{File: "/usr/bin/x", Hash: "sha256:abcd", Pid: 5, Ses: 1, Comm: "sh"},
+		},
+		{
+			AUDIT_CONFIG_CHANGE,
+			`auid=1000 ses=3 op=remove_rule key="watch" list=4 res=1`,
+			&ConfigChangeRecord{Op: "remove_rule", Key: "watch", List: 4, Auid: 1000, Ses: 3, Res: 1},
+		},
+		{
+			AUDIT_CONFIG_CHANGE,
+			`audit_backlog_limit=8192 old=64 auid=0 ses=1 res=1`,
+			&ConfigChangeRecord{Op: "set", Setting: "audit_backlog_limit", Value: "8192", OldValue: "64", Ses: 1, Res: 1},
+		},
+		{
+			AUDIT_FEATURE_CHANGE,
+			`pid=7 uid=0 auid=0 ses=1 feature=loginuid_immutable old=0 new=1 old_lock=0 new_lock=0 res=1`,
+			&ConfigChangeRecord{Setting: "loginuid_immutable", Value: "1", OldValue: "0", Pid: 7, Ses: 1, Res: 1},
+		},
+		{
+			AUDIT_IPC_SET_PERM,
+			`qbytes=4000 ouid=1000 ogid=1000 mode=0666`,
+			&IpcRecord{Ouid: 1000, Ogid: 1000, Mode: 0666, QBytes: 0x4000},
+		},
+		{
+			AUDIT_MQ_SENDRECV,
+			`mqdes=3 msg_len=16 msg_prio=1 abs_timeout_sec=0 abs_timeout_nsec=0`,
+			&MqSendRecvRecord{Mqdes: 3, MsgLen: 16, MsgPrio: 1},
+		},
+		{
+			AUDIT_CWD,
+			`cwd="/root"`,
+			&GenericRecord{},
+		},
+	}
+
+	for _, test := range tests {
+		rec := DecodeRecord(&AuditMessage{Type: test.msgType, Data: test.data})
+		if rec.RecordType() != test.msgType {
+			t.Errorf("%d: unexpected type %d", test.msgType, rec.RecordType())
+		}
+
+		// The raw fields are checked apart
+		fields := rec.RawFields()
+		if len(fields) == 0 {
+			t.Errorf("%d: no raw fields", test.msgType)
+		}
+
+		reflect.ValueOf(test.want).Elem().FieldByName("RecordFields").Set(
+			reflect.ValueOf(RecordFields{Type: test.msgType, Fields: fields}))
+		if !reflect.DeepEqual(rec, test.want) {
+			t.Errorf("%d: expected %+v, got %+v", test.msgType, test.want, rec)
+		}
+	}
+}
+
+func TestTokenizeAvc(t *testing.T) {
+	fields := tokenizeAvc(`avc:  granted  { setenforce } for  pid=1 scontext=a tcontext=b tclass=security`)
+	if fields["seresult"] != "granted" || fields["seperms"] != "setenforce" ||
+		fields["tclass"] != "security" || fields["pid"] != "1" {
+		t.Errorf("Unexpected fields %v", fields)
+	}
+}
@@ -0,0 +1,179 @@
+// +build linux
+
+package auditrd
+
+import (
+	"errors"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// DEFAULT_REQUEST_TIMEOUT bounds the wait for the kernel reply to a request
+// that doesn't set its own timeout.
+const DEFAULT_REQUEST_TIMEOUT = time.Second * 5
+
+var (
+	ErrRequestTimeout = errors.New("Timed out waiting for the netlink reply")
+	ErrClientClosed   = errors.New("Netlink client is closed")
+)
+
+// NetlinkRequest is a control message sent to the kernel along with the reply
+// expected for it.
+type NetlinkRequest struct {
+	Type    uint16
+	Payload []byte
+
+	// ReplyType is the message type carrying the answer, 0 if only the ACK
+	// is expected. A reply flagged NLM_F_MULTI is collected until NLMSG_DONE.
+	ReplyType uint16
+
+	// Timeout bounds the wait for the reply, DEFAULT_REQUEST_TIMEOUT if 0
+	Timeout time.Duration
+}
+
+// pendingRequest collects the replies to a request until it's complete
+type pendingRequest struct {
+	req     *NetlinkRequest
+	replies []*syscall.NetlinkMessage
+	done    chan error
+}
+
+// handle processes a reply to the request and tells if it's complete
+func (p *pendingRequest) handle(msg *syscall.NetlinkMessage) (bool, error) {
+	switch msg.Header.Type {
+	case syscall.NLMSG_ERROR:
+		if len(msg.Data) < 4 {
+			return true, errors.New("Truncated netlink error message")
+		}
+
+		// A negative errno is a failure, resetting the lost counter answers
+		// with the old counter as a positive value.
+		if code := int32(endianness.Uint32(msg.Data[0:4])); code < 0 {
+			return true, syscall.Errno(-code)
+		}
+
+		// The kernel may acknowledge before sending the reply
+		return p.req.ReplyType == 0, nil
+
+	case syscall.NLMSG_DONE:
+		return true, nil
+
+	case p.req.ReplyType:
+		p.replies = append(p.replies, msg)
+		return msg.Header.Flags&syscall.NLM_F_MULTI == 0, nil
+	}
+
+	return false, nil
+}
+
+// Request sends a control message to the kernel and waits for its reply. The
+// replies are matched to the request by sequence number and never show up in
+// Receive, so requests can be made while audit events are being read. A
+// NLMSG_ERROR reply is returned as a syscall.Errno.
+func (n *netlinkClient) Request(r *NetlinkRequest) ([]*syscall.NetlinkMessage, error) {
+	packet := &netlinkPacket{
+		Type:  r.Type,
+		Flags: syscall.NLM_F_REQUEST | syscall.NLM_F_ACK,
+		Pid:   uint32(syscall.Getpid()),
+	}
+
+	// Register before sending so that a quick reply is not dropped
+	p := n.register(packet, r)
+	if err := n.send(packet, r.Payload); err != nil {
+		n.unregister(packet.Seq)
+		return nil, err
+	}
+
+	return n.wait(packet.Seq, p)
+}
+
+// register assigns a sequence number to the packet and records the request
+// waiting for the reply to it.
+func (n *netlinkClient) register(np *netlinkPacket, r *NetlinkRequest) *pendingRequest {
+	np.Seq = atomic.AddUint32(&n.seq, 1)
+	p := &pendingRequest{req: r, done: make(chan error, 1)}
+
+	n.mu.Lock()
+	n.pending[np.Seq] = p
+	n.mu.Unlock()
+
+	return p
+}
+
+func (n *netlinkClient) unregister(seq uint32) *pendingRequest {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	p := n.pending[seq]
+	delete(n.pending, seq)
+	return p
+}
+
+// wait blocks until the request is complete or times out
+func (n *netlinkClient) wait(seq uint32, p *pendingRequest) ([]*syscall.NetlinkMessage, error) {
+	timeout := p.req.Timeout
+	if timeout == 0 {
+		timeout = DEFAULT_REQUEST_TIMEOUT
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case err := <-p.done:
+		if err != nil {
+			return nil, err
+		}
+		return p.replies, nil
+	case <-timer.C:
+		if n.unregister(seq) == nil {
+			// Completed while timing out
+			if err := <-p.done; err != nil {
+				return nil, err
+			}
+			return p.replies, nil
+		}
+		return nil, ErrRequestTimeout
+	}
+}
+
+// dispatch hands a control reply to the request waiting for it. It returns
+// false for audit events, which are left for Receive.
+func (n *netlinkClient) dispatch(msg *syscall.NetlinkMessage) bool {
+	// Audit events start at AUDIT_FIRST_USER_MSG, everything below is either a
+	// netlink control message or a reply to an audit request.
+	if msg.Header.Type >= AUDIT_FIRST_USER_MSG {
+		return false
+	}
+
+	n.mu.Lock()
+	p, ok := n.pending[msg.Header.Seq]
+	n.mu.Unlock()
+
+	if !ok {
+		glog.V(2).Infof("Dropping reply type %d for unknown sequence %d",
+			msg.Header.Type, msg.Header.Seq)
+		return true
+	}
+
+	if done, err := p.handle(msg); done {
+		n.unregister(msg.Header.Seq)
+		p.done <- err
+	}
+
+	return true
+}
+
+// failPending completes all the requests in flight with an error
+func (n *netlinkClient) failPending(err error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	for seq, p := range n.pending {
+		delete(n.pending, seq)
+		p.done <- err
+	}
+}
@@ -0,0 +1,104 @@
+package auditrd
+
+import (
+	"syscall"
+	"testing"
+	"time"
+)
+
+func newTestNetlinkClient() *netlinkClient {
+	return &netlinkClient{
+		pending:  make(map[uint32]*pendingRequest),
+		messages: make(chan receiveResult, RECEIVE_QUEUE_SIZE),
+	}
+}
+
+func nlReply(seq uint32, msgType, flags uint16, data []byte) *syscall.NetlinkMessage {
+	return &syscall.NetlinkMessage{
+		Header: syscall.NlMsghdr{Type: msgType, Flags: flags, Seq: seq},
+		Data:   data,
+	}
+}
+
+func nlError(seq uint32, code int32) *syscall.NetlinkMessage {
+	data := make([]byte, 4+syscall.SizeofNlMsghdr)
+	endianness.PutUint32(data, uint32(code))
+	return nlReply(seq, syscall.NLMSG_ERROR, 0, data)
+}
+
+func TestRequestMultipartReply(t *testing.T) {
+	n := newTestNetlinkClient()
+	packet := &netlinkPacket{}
+	p := n.register(packet, &NetlinkRequest{
+		Type:      AUDIT_LIST_RULES,
+		ReplyType: AUDIT_LIST_RULES,
+	})
+
+	go func() {
+		// The ACK comes first since the kernel sends the list from a thread
+		n.dispatch(nlError(packet.Seq, 0))
+		n.dispatch(nlReply(packet.Seq, AUDIT_LIST_RULES, syscall.NLM_F_MULTI, []byte{1}))
+		n.dispatch(nlReply(packet.Seq+1, AUDIT_LIST_RULES, syscall.NLM_F_MULTI, []byte{9}))
+		n.dispatch(nlReply(packet.Seq, AUDIT_LIST_RULES, syscall.NLM_F_MULTI, []byte{2}))
+		n.dispatch(nlReply(packet.Seq, syscall.NLMSG_DONE, syscall.NLM_F_MULTI, nil))
+	}()
+
+	replies, err := n.wait(packet.Seq, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(replies) != 2 || replies[0].Data[0] != 1 || replies[1].Data[0] != 2 {
+		t.Errorf("Unexpected replies %v", replies)
+	}
+
+	if len(n.pending) != 0 {
+		t.Error("Request should not be pending anymore")
+	}
+}
+
+func TestRequestError(t *testing.T) {
+	n := newTestNetlinkClient()
+	packet := &netlinkPacket{}
+	p := n.register(packet, &NetlinkRequest{Type: AUDIT_ADD_RULE})
+
+	n.dispatch(nlError(packet.Seq, -int32(syscall.EEXIST)))
+
+	if _, err := n.wait(packet.Seq, p); err != syscall.EEXIST {
+		t.Errorf("Expected EEXIST, got %v", err)
+	}
+}
+
+func TestRequestTimeout(t *testing.T) {
+	n := newTestNetlinkClient()
+	packet := &netlinkPacket{}
+	p := n.register(packet, &NetlinkRequest{
+		Type:      AUDIT_GET,
+		ReplyType: AUDIT_GET,
+		Timeout:   time.Millisecond * 10,
+	})
+
+	// An ACK alone doesn't complete a request expecting a reply
+	n.dispatch(nlError(packet.Seq, 0))
+
+	if _, err := n.wait(packet.Seq, p); err != ErrRequestTimeout {
+		t.Errorf("Expected a timeout, got %v", err)
+	}
+
+	if len(n.pending) != 0 {
+		t.Error("Timed out request should not be pending anymore")
+	}
+}
+
+func TestDispatchKeepsEvents(t *testing.T) {
+	n := newTestNetlinkClient()
+
+	if n.dispatch(msg1300()) {
+		t.Error("Audit events should be left for Receive")
+	}
+
+	if !n.dispatch(nlError(42, 0)) {
+		t.Error("Stray ACKs should not reach Receive")
+	}
+}
+
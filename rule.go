@@ -0,0 +1,316 @@
+package auditrd
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+// Filter lists a rule can be attached to, see
+// https://github.com/torvalds/linux/blob/v5.6/include/uapi/linux/audit.h#L160
+const (
+	AUDIT_FILTER_USER    uint32 = 0x00 /* Apply rule to user-generated messages */
+	AUDIT_FILTER_TASK    uint32 = 0x01 /* Apply rule at task creation (not syscall) */
+	AUDIT_FILTER_ENTRY   uint32 = 0x02 /* Apply rule at syscall entry -- deprecated */
+	AUDIT_FILTER_WATCH   uint32 = 0x03 /* Apply rule to file system watches */
+	AUDIT_FILTER_EXIT    uint32 = 0x04 /* Apply rule at syscall exit */
+	AUDIT_FILTER_EXCLUDE uint32 = 0x05 /* Apply rule before record creation */
+	AUDIT_FILTER_FS      uint32 = 0x06 /* Apply rule at __audit_inode_child */
+
+	AUDIT_FILTER_PREPEND uint32 = 0x10 /* Prepend to front of list */
+)
+
+// Rule actions
+const (
+	AUDIT_NEVER    uint32 = 0 /* Do not build context if rule matches */
+	AUDIT_POSSIBLE uint32 = 1 /* Build context if rule matches */
+	AUDIT_ALWAYS   uint32 = 2 /* Generate audit record if rule matches */
+)
+
+// Rule fields
+const (
+	AUDIT_PID          uint32 = 0
+	AUDIT_UID          uint32 = 1
+	AUDIT_EUID         uint32 = 2
+	AUDIT_SUID         uint32 = 3
+	AUDIT_FSUID        uint32 = 4
+	AUDIT_GID          uint32 = 5
+	AUDIT_EGID         uint32 = 6
+	AUDIT_SGID         uint32 = 7
+	AUDIT_FSGID        uint32 = 8
+	AUDIT_LOGINUID     uint32 = 9
+	AUDIT_PERS         uint32 = 10
+	AUDIT_ARCH         uint32 = 11
+	AUDIT_MSGTYPE      uint32 = 12
+	AUDIT_SUBJ_USER    uint32 = 13 /* security label user */
+	AUDIT_SUBJ_ROLE    uint32 = 14 /* security label role */
+	AUDIT_SUBJ_TYPE    uint32 = 15 /* security label type */
+	AUDIT_SUBJ_SEN     uint32 = 16 /* security label sensitivity label */
+	AUDIT_SUBJ_CLR     uint32 = 17 /* security label clearance label */
+	AUDIT_PPID         uint32 = 18
+	AUDIT_OBJ_USER     uint32 = 19
+	AUDIT_OBJ_ROLE     uint32 = 20
+	AUDIT_OBJ_TYPE     uint32 = 21
+	AUDIT_OBJ_LEV_LOW  uint32 = 22
+	AUDIT_OBJ_LEV_HIGH uint32 = 23
+	AUDIT_LOGINUID_SET uint32 = 24
+	AUDIT_SESSIONID    uint32 = 25 /* Session ID */
+	AUDIT_FSTYPE       uint32 = 26 /* FileSystem Type */
+
+	AUDIT_DEVMAJOR      uint32 = 100
+	AUDIT_DEVMINOR      uint32 = 101
+	AUDIT_INODE         uint32 = 102
+	AUDIT_EXIT          uint32 = 103
+	AUDIT_SUCCESS       uint32 = 104 /* exit >= 0; value ignored */
+	AUDIT_WATCH         uint32 = 105
+	AUDIT_PERM          uint32 = 106
+	AUDIT_DIR           uint32 = 107
+	AUDIT_FILETYPE      uint32 = 108
+	AUDIT_OBJ_UID       uint32 = 109
+	AUDIT_OBJ_GID       uint32 = 110
+	AUDIT_FIELD_COMPARE uint32 = 111
+	AUDIT_EXE           uint32 = 112
+	AUDIT_SADDR_FAM     uint32 = 113
+
+	AUDIT_ARG0 uint32 = 200
+	AUDIT_ARG1 uint32 = AUDIT_ARG0 + 1
+	AUDIT_ARG2 uint32 = AUDIT_ARG0 + 2
+	AUDIT_ARG3 uint32 = AUDIT_ARG0 + 3
+
+	AUDIT_FILTERKEY uint32 = 210
+)
+
+// Rule field operators
+const (
+	AUDIT_BIT_MASK              uint32 = 0x08000000
+	AUDIT_LESS_THAN             uint32 = 0x10000000
+	AUDIT_GREATER_THAN          uint32 = 0x20000000
+	AUDIT_NOT_EQUAL             uint32 = 0x30000000
+	AUDIT_EQUAL                 uint32 = 0x40000000
+	AUDIT_BIT_TEST              uint32 = AUDIT_BIT_MASK | AUDIT_EQUAL
+	AUDIT_LESS_THAN_OR_EQUAL    uint32 = AUDIT_LESS_THAN | AUDIT_EQUAL
+	AUDIT_GREATER_THAN_OR_EQUAL uint32 = AUDIT_GREATER_THAN | AUDIT_EQUAL
+)
+
+// Permissions for AUDIT_PERM fields
+const (
+	AUDIT_PERM_EXEC  uint32 = 1
+	AUDIT_PERM_WRITE uint32 = 2
+	AUDIT_PERM_READ  uint32 = 4
+	AUDIT_PERM_ATTR  uint32 = 8
+)
+
+// Architectures for AUDIT_ARCH fields
+const (
+	AUDIT_ARCH_I386    uint32 = 0x40000003
+	AUDIT_ARCH_X86_64  uint32 = 0xc000003e
+	AUDIT_ARCH_ARM     uint32 = 0x40000028
+	AUDIT_ARCH_AARCH64 uint32 = 0xc00000b7
+)
+
+const (
+	AUDIT_MAX_FIELDS    = 64
+	AUDIT_MAX_KEY_LEN   = 256
+	AUDIT_BITMASK_SIZE  = 64
+	AUDIT_KEY_SEPARATOR = 0x01
+)
+
+// auditRuleData mirrors the fixed size part of struct audit_rule_data, the
+// string buffer follows it on the wire.
+// See https://github.com/torvalds/linux/blob/v5.6/include/uapi/linux/audit.h#L486
+type auditRuleData struct {
+	Flags      uint32
+	Action     uint32
+	FieldCount uint32
+	Mask       [AUDIT_BITMASK_SIZE]uint32
+	Fields     [AUDIT_MAX_FIELDS]uint32
+	Values     [AUDIT_MAX_FIELDS]uint32
+	FieldFlags [AUDIT_MAX_FIELDS]uint32
+	BufLen     uint32
+}
+
+// sizeofAuditRuleData is the length of the fixed size part of the rule.
+var sizeofAuditRuleData = binary.Size(auditRuleData{})
+
+// AuditRuleField is a single comparison in an audit rule. For string fields
+// such as AUDIT_WATCH, AUDIT_DIR or AUDIT_EXE the value is taken from Str and
+// Value is ignored.
+type AuditRuleField struct {
+	Field uint32
+	Op    uint32
+	Value uint32
+	Str   string
+}
+
+// AuditRule is the typed representation of a kernel audit rule.
+type AuditRule struct {
+	// List is the filter list the rule is attached to, AUDIT_FILTER_EXIT for
+	// the usual syscall rules.
+	List uint32
+
+	// Action is AUDIT_ALWAYS or AUDIT_NEVER.
+	Action uint32
+
+	// Syscalls holds the syscall numbers the rule applies to. It's ignored
+	// when AllSyscalls is set.
+	Syscalls    []int
+	AllSyscalls bool
+
+	// Arch is the AUDIT_ARCH_* value the rule is restricted to, 0 if the rule
+	// has no arch field.
+	Arch uint32
+
+	Fields []AuditRuleField
+	Keys   []string
+
+	// raw holds the rule exactly as the kernel reported it so that a rule
+	// returned from ListRules can be deleted even if the fields were reordered.
+	raw []byte
+}
+
+// isStringField tells if the value of a field is carried in the string buffer
+// of the rule rather than in the values array.
+func isStringField(field uint32) bool {
+	switch field {
+	case AUDIT_SUBJ_USER, AUDIT_SUBJ_ROLE, AUDIT_SUBJ_TYPE, AUDIT_SUBJ_SEN,
+		AUDIT_SUBJ_CLR, AUDIT_OBJ_USER, AUDIT_OBJ_ROLE, AUDIT_OBJ_TYPE,
+		AUDIT_OBJ_LEV_LOW, AUDIT_OBJ_LEV_HIGH, AUDIT_WATCH, AUDIT_DIR,
+		AUDIT_FILTERKEY, AUDIT_EXE:
+		return true
+	}
+	return false
+}
+
+// marshal encodes the rule as a struct audit_rule_data followed by the string
+// buffer.
+func (r *AuditRule) marshal() ([]byte, error) {
+	var rd auditRuleData
+	var strbuf bytes.Buffer
+
+	rd.Flags = r.List
+	rd.Action = r.Action
+
+	if r.AllSyscalls {
+		for i := range rd.Mask {
+			rd.Mask[i] = ^uint32(0)
+		}
+	} else {
+		for _, s := range r.Syscalls {
+			if s < 0 || s >= AUDIT_BITMASK_SIZE*32 {
+				return nil, fmt.Errorf("Syscall number out of range: %d", s)
+			}
+			rd.Mask[s/32] |= 1 << uint(s%32)
+		}
+	}
+
+	fields := make([]AuditRuleField, 0, len(r.Fields)+2)
+	if r.Arch != 0 {
+		fields = append(fields, AuditRuleField{
+			Field: AUDIT_ARCH, Op: AUDIT_EQUAL, Value: r.Arch,
+		})
+	}
+	fields = append(fields, r.Fields...)
+	if len(r.Keys) > 0 {
+		key := strings.Join(r.Keys, string(rune(AUDIT_KEY_SEPARATOR)))
+		if len(key) > AUDIT_MAX_KEY_LEN {
+			return nil, fmt.Errorf("Rule key is longer than %d bytes", AUDIT_MAX_KEY_LEN)
+		}
+		fields = append(fields, AuditRuleField{
+			Field: AUDIT_FILTERKEY, Op: AUDIT_EQUAL, Str: key,
+		})
+	}
+
+	if len(fields) > AUDIT_MAX_FIELDS {
+		return nil, fmt.Errorf("Rule has more than %d fields", AUDIT_MAX_FIELDS)
+	}
+
+	for i, f := range fields {
+		rd.Fields[i] = f.Field
+		rd.FieldFlags[i] = f.Op
+		if isStringField(f.Field) {
+			rd.Values[i] = uint32(len(f.Str))
+			strbuf.WriteString(f.Str)
+		} else {
+			rd.Values[i] = f.Value
+		}
+	}
+	rd.FieldCount = uint32(len(fields))
+	rd.BufLen = uint32(strbuf.Len())
+
+	buf := new(bytes.Buffer)
+	binary.Write(buf, endianness, &rd)
+	buf.Write(strbuf.Bytes())
+	return buf.Bytes(), nil
+}
+
+// unmarshalAuditRule decodes a struct audit_rule_data as sent by the kernel in
+// reply to AUDIT_LIST_RULES.
+func unmarshalAuditRule(data []byte) (*AuditRule, error) {
+	if len(data) < sizeofAuditRuleData {
+		return nil, fmt.Errorf("Rule too short: %d bytes", len(data))
+	}
+
+	var rd auditRuleData
+	if err := binary.Read(
+		bytes.NewReader(data[:sizeofAuditRuleData]), endianness, &rd); err != nil {
+		return nil, err
+	}
+
+	strbuf := data[sizeofAuditRuleData:]
+	if int(rd.BufLen) > len(strbuf) || rd.FieldCount > AUDIT_MAX_FIELDS {
+		return nil, fmt.Errorf("Malformed rule")
+	}
+
+	r := &AuditRule{
+		List:        rd.Flags,
+		Action:      rd.Action,
+		AllSyscalls: true,
+		raw:         append([]byte(nil), data[:sizeofAuditRuleData+int(rd.BufLen)]...),
+	}
+
+	for i := range rd.Mask {
+		if rd.Mask[i] != ^uint32(0) {
+			r.AllSyscalls = false
+			break
+		}
+	}
+	if !r.AllSyscalls {
+		for i := 0; i < AUDIT_BITMASK_SIZE*32; i++ {
+			if rd.Mask[i/32]&(1<<uint(i%32)) != 0 {
+				r.Syscalls = append(r.Syscalls, i)
+			}
+		}
+	}
+
+	offset := uint32(0)
+	for i := uint32(0); i < rd.FieldCount; i++ {
+		f := AuditRuleField{
+			Field: rd.Fields[i],
+			Op:    rd.FieldFlags[i],
+			Value: rd.Values[i],
+		}
+
+		if isStringField(f.Field) {
+			// offset <= BufLen, the check can't wrap around
+			if f.Value > rd.BufLen-offset {
+				return nil, fmt.Errorf("Malformed rule string field %d", f.Field)
+			}
+			f.Str = string(strbuf[offset : offset+f.Value])
+			offset += f.Value
+			f.Value = 0
+		}
+
+		switch {
+		case f.Field == AUDIT_ARCH && f.Op == AUDIT_EQUAL && r.Arch == 0:
+			r.Arch = f.Value
+		case f.Field == AUDIT_FILTERKEY:
+			r.Keys = append(r.Keys,
+				strings.Split(f.Str, string(rune(AUDIT_KEY_SEPARATOR)))...)
+		default:
+			r.Fields = append(r.Fields, f)
+		}
+	}
+
+	return r, nil
+}
@@ -0,0 +1,105 @@
+package auditrd
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAuditRuleMarshal(t *testing.T) {
+	r := &AuditRule{
+		List:     AUDIT_FILTER_EXIT,
+		Action:   AUDIT_ALWAYS,
+		Syscalls: []int{2, 59, 257},
+		Arch:     AUDIT_ARCH_X86_64,
+		Fields: []AuditRuleField{
+			{Field: AUDIT_LOGINUID, Op: AUDIT_GREATER_THAN_OR_EQUAL, Value: 1000},
+			{Field: AUDIT_EXE, Op: AUDIT_EQUAL, Str: "/usr/bin/sudo"},
+		},
+		Keys: []string{"exec", "priv"},
+	}
+
+	data, err := r.marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(data) != sizeofAuditRuleData+len("/usr/bin/sudo")+len("exec\x01priv") {
+		t.Fatalf("Unexpected rule length %d", len(data))
+	}
+
+	decoded, err := unmarshalAuditRule(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(decoded.raw, data) {
+		t.Error("Raw rule should be kept")
+	}
+	decoded.raw = nil
+
+	if !reflect.DeepEqual(r, decoded) {
+		t.Errorf("Rule mismatch\nwant: %+v\ngot:  %+v", r, decoded)
+	}
+}
+
+func TestAuditRuleAllSyscalls(t *testing.T) {
+	r := &AuditRule{
+		List:        AUDIT_FILTER_EXIT,
+		Action:      AUDIT_ALWAYS,
+		AllSyscalls: true,
+		Fields: []AuditRuleField{
+			{Field: AUDIT_WATCH, Op: AUDIT_EQUAL, Str: "/etc/passwd"},
+			{Field: AUDIT_PERM, Op: AUDIT_EQUAL, Value: AUDIT_PERM_WRITE | AUDIT_PERM_ATTR},
+		},
+	}
+
+	data, err := r.marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded, err := unmarshalAuditRule(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !decoded.AllSyscalls || len(decoded.Syscalls) != 0 {
+		t.Error("Expected a rule for all syscalls")
+	}
+
+	if decoded.Fields[0].Str != "/etc/passwd" || decoded.Fields[1].Value != 10 {
+		t.Errorf("Unexpected fields %+v", decoded.Fields)
+	}
+}
+
+func TestAuditRuleLimits(t *testing.T) {
+	r := &AuditRule{Syscalls: []int{AUDIT_BITMASK_SIZE * 32}}
+	if _, err := r.marshal(); err == nil {
+		t.Error("Expected an error for an out of range syscall")
+	}
+
+	r = &AuditRule{Fields: make([]AuditRuleField, AUDIT_MAX_FIELDS), Arch: AUDIT_ARCH_X86_64}
+	if _, err := r.marshal(); err == nil {
+		t.Error("Expected an error for too many fields")
+	}
+
+	if _, err := unmarshalAuditRule(make([]byte, 10)); err == nil {
+		t.Error("Expected an error for a truncated rule")
+	}
+
+	// A string field length that wraps the offset around
+	r = &AuditRule{
+		Fields: []AuditRuleField{{Field: AUDIT_EXE, Op: AUDIT_EQUAL, Str: "/bin/sh"}},
+		Keys:   []string{"exec"},
+	}
+	data, err := r.marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	values := 4*3 + 4*AUDIT_BITMASK_SIZE + 4*AUDIT_MAX_FIELDS
+	endianness.PutUint32(data[values+4:], ^uint32(0)-1)
+	if _, err := unmarshalAuditRule(data); err == nil {
+		t.Error("Expected an error for a huge field length")
+	}
+}
@@ -0,0 +1,298 @@
+package rules
+
+import (
+	"os/user"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/open-osquery/auditrd"
+)
+
+// valueKind tells how the value of a -F field is interpreted
+type valueKind int
+
+const (
+	numericValue valueKind = iota
+	uidValue
+	gidValue
+	stringValue
+	archValue
+	exitValue
+	permValue
+	fileTypeValue
+	successValue
+)
+
+type fieldDef struct {
+	field uint32
+	kind  valueKind
+}
+
+// fields maps the names accepted by auditctl -F to the kernel field ids
+var fields = map[string]fieldDef{
+	"pid":          {auditrd.AUDIT_PID, numericValue},
+	"uid":          {auditrd.AUDIT_UID, uidValue},
+	"euid":         {auditrd.AUDIT_EUID, uidValue},
+	"suid":         {auditrd.AUDIT_SUID, uidValue},
+	"fsuid":        {auditrd.AUDIT_FSUID, uidValue},
+	"gid":          {auditrd.AUDIT_GID, gidValue},
+	"egid":         {auditrd.AUDIT_EGID, gidValue},
+	"sgid":         {auditrd.AUDIT_SGID, gidValue},
+	"fsgid":        {auditrd.AUDIT_FSGID, gidValue},
+	"auid":         {auditrd.AUDIT_LOGINUID, uidValue},
+	"loginuid":     {auditrd.AUDIT_LOGINUID, uidValue},
+	"pers":         {auditrd.AUDIT_PERS, numericValue},
+	"arch":         {auditrd.AUDIT_ARCH, archValue},
+	"msgtype":      {auditrd.AUDIT_MSGTYPE, numericValue},
+	"subj_user":    {auditrd.AUDIT_SUBJ_USER, stringValue},
+	"subj_role":    {auditrd.AUDIT_SUBJ_ROLE, stringValue},
+	"subj_type":    {auditrd.AUDIT_SUBJ_TYPE, stringValue},
+	"subj_sen":     {auditrd.AUDIT_SUBJ_SEN, stringValue},
+	"subj_clr":     {auditrd.AUDIT_SUBJ_CLR, stringValue},
+	"ppid":         {auditrd.AUDIT_PPID, numericValue},
+	"obj_user":     {auditrd.AUDIT_OBJ_USER, stringValue},
+	"obj_role":     {auditrd.AUDIT_OBJ_ROLE, stringValue},
+	"obj_type":     {auditrd.AUDIT_OBJ_TYPE, stringValue},
+	"obj_lev_low":  {auditrd.AUDIT_OBJ_LEV_LOW, stringValue},
+	"obj_lev_high": {auditrd.AUDIT_OBJ_LEV_HIGH, stringValue},
+	"loginuid_set": {auditrd.AUDIT_LOGINUID_SET, numericValue},
+	"sessionid":    {auditrd.AUDIT_SESSIONID, numericValue},
+	"fstype":       {auditrd.AUDIT_FSTYPE, numericValue},
+	"devmajor":     {auditrd.AUDIT_DEVMAJOR, numericValue},
+	"devminor":     {auditrd.AUDIT_DEVMINOR, numericValue},
+	"inode":        {auditrd.AUDIT_INODE, numericValue},
+	"exit":         {auditrd.AUDIT_EXIT, exitValue},
+	"success":      {auditrd.AUDIT_SUCCESS, successValue},
+	"path":         {auditrd.AUDIT_WATCH, stringValue},
+	"perm":         {auditrd.AUDIT_PERM, permValue},
+	"dir":          {auditrd.AUDIT_DIR, stringValue},
+	"filetype":     {auditrd.AUDIT_FILETYPE, fileTypeValue},
+	"obj_uid":      {auditrd.AUDIT_OBJ_UID, uidValue},
+	"obj_gid":      {auditrd.AUDIT_OBJ_GID, gidValue},
+	"exe":          {auditrd.AUDIT_EXE, stringValue},
+	"saddr_fam":    {auditrd.AUDIT_SADDR_FAM, numericValue},
+	"a0":           {auditrd.AUDIT_ARG0, numericValue},
+	"a1":           {auditrd.AUDIT_ARG1, numericValue},
+	"a2":           {auditrd.AUDIT_ARG2, numericValue},
+	"a3":           {auditrd.AUDIT_ARG3, numericValue},
+	"key":          {auditrd.AUDIT_FILTERKEY, stringValue},
+}
+
+// operators accepted by -F, the two character ones must be matched first
+var operators = []struct {
+	token string
+	op    uint32
+}{
+	{"!=", auditrd.AUDIT_NOT_EQUAL},
+	{"<=", auditrd.AUDIT_LESS_THAN_OR_EQUAL},
+	{">=", auditrd.AUDIT_GREATER_THAN_OR_EQUAL},
+	{"&=", auditrd.AUDIT_BIT_TEST},
+	{"=", auditrd.AUDIT_EQUAL},
+	{"<", auditrd.AUDIT_LESS_THAN},
+	{">", auditrd.AUDIT_GREATER_THAN},
+	{"&", auditrd.AUDIT_BIT_MASK},
+}
+
+// Field to field comparisons for -C, see
+// https://github.com/torvalds/linux/blob/v5.6/include/uapi/linux/audit.h#L208
+var comparisons = map[[2]string]uint32{
+	{"uid", "obj_uid"}:      1,
+	{"gid", "obj_gid"}:      2,
+	{"euid", "obj_uid"}:     3,
+	{"egid", "obj_gid"}:     4,
+	{"auid", "obj_uid"}:     5,
+	{"suid", "obj_uid"}:     6,
+	{"sgid", "obj_gid"}:     7,
+	{"fsuid", "obj_uid"}:    8,
+	{"fsgid", "obj_gid"}:    9,
+	{"uid", "auid"}:         10,
+	{"uid", "euid"}:         11,
+	{"uid", "fsuid"}:        12,
+	{"uid", "suid"}:         13,
+	{"auid", "fsuid"}:       14,
+	{"auid", "suid"}:        15,
+	{"auid", "euid"}:        16,
+	{"euid", "suid"}:        17,
+	{"euid", "fsuid"}:       18,
+	{"suid", "fsuid"}:       19,
+	{"gid", "egid"}:         20,
+	{"gid", "fsgid"}:        21,
+	{"gid", "sgid"}:         22,
+	{"egid", "fsgid"}:       23,
+	{"egid", "sgid"}:        24,
+	{"sgid", "fsgid"}:       25,
+	{"loginuid", "obj_uid"}: 5,
+}
+
+var lists = map[string]uint32{
+	"task":       auditrd.AUDIT_FILTER_TASK,
+	"exit":       auditrd.AUDIT_FILTER_EXIT,
+	"user":       auditrd.AUDIT_FILTER_USER,
+	"exclude":    auditrd.AUDIT_FILTER_EXCLUDE,
+	"filesystem": auditrd.AUDIT_FILTER_FS,
+}
+
+var actions = map[string]uint32{
+	"never":  auditrd.AUDIT_NEVER,
+	"always": auditrd.AUDIT_ALWAYS,
+}
+
+var fileTypes = map[string]uint32{
+	"file":      syscall.S_IFREG,
+	"dir":       syscall.S_IFDIR,
+	"socket":    syscall.S_IFSOCK,
+	"link":      syscall.S_IFLNK,
+	"character": syscall.S_IFCHR,
+	"block":     syscall.S_IFBLK,
+	"fifo":      syscall.S_IFIFO,
+}
+
+var errnos = map[string]syscall.Errno{
+	"EPERM":        syscall.EPERM,
+	"ENOENT":       syscall.ENOENT,
+	"ESRCH":        syscall.ESRCH,
+	"EINTR":        syscall.EINTR,
+	"EIO":          syscall.EIO,
+	"ENXIO":        syscall.ENXIO,
+	"E2BIG":        syscall.E2BIG,
+	"ENOEXEC":      syscall.ENOEXEC,
+	"EBADF":        syscall.EBADF,
+	"ECHILD":       syscall.ECHILD,
+	"EAGAIN":       syscall.EAGAIN,
+	"ENOMEM":       syscall.ENOMEM,
+	"EACCES":       syscall.EACCES,
+	"EFAULT":       syscall.EFAULT,
+	"EBUSY":        syscall.EBUSY,
+	"EEXIST":       syscall.EEXIST,
+	"EXDEV":        syscall.EXDEV,
+	"ENODEV":       syscall.ENODEV,
+	"ENOTDIR":      syscall.ENOTDIR,
+	"EISDIR":       syscall.EISDIR,
+	"EINVAL":       syscall.EINVAL,
+	"ENFILE":       syscall.ENFILE,
+	"EMFILE":       syscall.EMFILE,
+	"ENOTTY":       syscall.ENOTTY,
+	"ETXTBSY":      syscall.ETXTBSY,
+	"EFBIG":        syscall.EFBIG,
+	"ENOSPC":       syscall.ENOSPC,
+	"ESPIPE":       syscall.ESPIPE,
+	"EROFS":        syscall.EROFS,
+	"EMLINK":       syscall.EMLINK,
+	"EPIPE":        syscall.EPIPE,
+	"ENAMETOOLONG": syscall.ENAMETOOLONG,
+	"ENOSYS":       syscall.ENOSYS,
+	"ENOTEMPTY":    syscall.ENOTEMPTY,
+	"ELOOP":        syscall.ELOOP,
+	"EOPNOTSUPP":   syscall.EOPNOTSUPP,
+	"EADDRINUSE":   syscall.EADDRINUSE,
+	"ECONNREFUSED": syscall.ECONNREFUSED,
+	"ETIMEDOUT":    syscall.ETIMEDOUT,
+}
+
+// parseArch resolves the value of an arch field. b64 and b32 are relative to
+// the architecture auditrd was built for.
+func parseArch(v string) (uint32, bool) {
+	switch v {
+	case "b64":
+		switch runtime.GOARCH {
+		case "amd64":
+			return auditrd.AUDIT_ARCH_X86_64, true
+		case "arm64":
+			return auditrd.AUDIT_ARCH_AARCH64, true
+		}
+	case "b32":
+		switch runtime.GOARCH {
+		case "amd64", "386":
+			return auditrd.AUDIT_ARCH_I386, true
+		case "arm64", "arm":
+			return auditrd.AUDIT_ARCH_ARM, true
+		}
+	case "x86_64":
+		return auditrd.AUDIT_ARCH_X86_64, true
+	case "i386", "i486", "i586", "i686":
+		return auditrd.AUDIT_ARCH_I386, true
+	case "aarch64":
+		return auditrd.AUDIT_ARCH_AARCH64, true
+	case "arm", "armeb", "armv7l":
+		return auditrd.AUDIT_ARCH_ARM, true
+	default:
+		if n, err := strconv.ParseUint(v, 0, 32); err == nil {
+			return uint32(n), true
+		}
+	}
+	return 0, false
+}
+
+// parseID resolves a uid or gid given either as a number, as "unset" or as a
+// user or group name.
+func parseID(v string, group bool) (uint32, bool) {
+	if v == "unset" || v == "-1" {
+		return ^uint32(0), true
+	}
+	if n, err := strconv.ParseUint(v, 10, 32); err == nil {
+		return uint32(n), true
+	}
+
+	var id string
+	if group {
+		g, err := user.LookupGroup(v)
+		if err != nil {
+			return 0, false
+		}
+		id = g.Gid
+	} else {
+		u, err := user.Lookup(v)
+		if err != nil {
+			return 0, false
+		}
+		id = u.Uid
+	}
+
+	n, err := strconv.ParseUint(id, 10, 32)
+	return uint32(n), err == nil
+}
+
+// parseExit resolves an exit value given either as a number or as a,
+// possibly negated, errno name such as -EACCES.
+func parseExit(v string) (uint32, bool) {
+	if n, err := strconv.ParseInt(v, 0, 32); err == nil {
+		return uint32(int32(n)), true
+	}
+
+	neg := strings.HasPrefix(v, "-")
+	e, ok := errnos[strings.TrimPrefix(v, "-")]
+	if !ok {
+		return 0, false
+	}
+	if neg {
+		return uint32(-int32(e)), true
+	}
+	return uint32(e), true
+}
+
+// parsePerm converts the rwxa permission string of a watch to the AUDIT_PERM_*
+// bits.
+func parsePerm(v string) (uint32, bool) {
+	var perm uint32
+	if len(v) == 0 || len(v) > 4 {
+		return 0, false
+	}
+
+	for _, c := range v {
+		switch c {
+		case 'r':
+			perm |= auditrd.AUDIT_PERM_READ
+		case 'w':
+			perm |= auditrd.AUDIT_PERM_WRITE
+		case 'x':
+			perm |= auditrd.AUDIT_PERM_EXEC
+		case 'a':
+			perm |= auditrd.AUDIT_PERM_ATTR
+		default:
+			return 0, false
+		}
+	}
+	return perm, true
+}
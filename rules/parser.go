@@ -0,0 +1,538 @@
+package rules
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/open-osquery/auditrd"
+)
+
+// lookupSyscall resolves the names given to -S in the table of the rule arch,
+// it's a variable so that tests don't depend on the syscall tables of the host.
+var lookupSyscall = auditrd.LookupArchSyscall
+
+// ParseError reports where a rules file is invalid. Line and Column are 1
+// based.
+type ParseError struct {
+	File   string
+	Line   int
+	Column int
+	Msg    string
+}
+
+func (e *ParseError) Error() string {
+	if e.File != "" {
+		return fmt.Sprintf("%s:%d:%d: %s", e.File, e.Line, e.Column, e.Msg)
+	}
+	return fmt.Sprintf("%d:%d: %s", e.Line, e.Column, e.Msg)
+}
+
+// token is a whitespace separated word of a rule line along with the column
+// it starts at.
+type token struct {
+	text string
+	col  int
+}
+
+// ParseFile parses a rules file in the auditctl syntax
+func ParseFile(path string) ([]Command, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	cmds, err := Parse(f)
+	if perr, ok := err.(*ParseError); ok {
+		perr.File = path
+	}
+	return cmds, err
+}
+
+// Parse reads rules in the auditctl syntax, one per line. Empty lines and lines
+// starting with # are skipped. The whole input is parsed before returning so
+// either every command is returned or the first error is.
+func Parse(r io.Reader) ([]Command, error) {
+	var cmds []Command
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		cmd, err := parseLine(line, scanner.Text())
+		if err != nil {
+			return nil, err
+		}
+		if cmd != nil {
+			cmds = append(cmds, *cmd)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return cmds, nil
+}
+
+func splitLine(s string) []token {
+	var toks []token
+	start := -1
+	for i := 0; i <= len(s); i++ {
+		if i == len(s) || s[i] == ' ' || s[i] == '\t' {
+			if start >= 0 {
+				toks = append(toks, token{text: s[start:i], col: start + 1})
+				start = -1
+			}
+			continue
+		}
+		if start < 0 {
+			start = i
+		}
+	}
+	return toks
+}
+
+// lineParser holds the state of a single rule line being parsed
+type lineParser struct {
+	line int
+	toks []token
+	pos  int
+
+	cmd        *Command
+	watch      *token
+	perm       *token
+	sawSyscall bool
+
+	// syscallNames are the syscalls given to -S, resolved once the arch of
+	// the rule is known.
+	syscallNames []token
+}
+
+func (p *lineParser) errorf(col int, format string, args ...interface{}) error {
+	return &ParseError{Line: p.line, Column: col, Msg: fmt.Sprintf(format, args...)}
+}
+
+// arg returns the argument of the option at the current position
+func (p *lineParser) arg() (token, error) {
+	opt := p.toks[p.pos]
+	if p.pos+1 >= len(p.toks) {
+		return token{}, p.errorf(opt.col, "option %s requires an argument", opt.text)
+	}
+	p.pos++
+	return p.toks[p.pos], nil
+}
+
+// setKind records the operation of the line, a line can only have one
+func (p *lineParser) setKind(t token, kind CommandKind) error {
+	if p.cmd.Rule != nil || p.cmd.Kind != AddRule || p.cmd.Option != "" {
+		return p.errorf(t.col, "option %s conflicts with a previous option", t.text)
+	}
+	p.cmd.Kind = kind
+	return nil
+}
+
+func parseLine(line int, text string) (*Command, error) {
+	toks := splitLine(text)
+	if len(toks) == 0 || strings.HasPrefix(toks[0].text, "#") {
+		return nil, nil
+	}
+
+	p := &lineParser{line: line, toks: toks, cmd: &Command{Line: line}}
+	for ; p.pos < len(toks); p.pos++ {
+		t := toks[p.pos]
+		var err error
+
+		switch t.text {
+		case "-a", "-A", "-d":
+			err = p.parseRuleOption(t)
+		case "-w", "-W":
+			err = p.parseWatchOption(t)
+		case "-p":
+			err = p.parsePermOption(t)
+		case "-S":
+			err = p.parseSyscallOption(t)
+		case "-F":
+			err = p.parseFieldOption(t)
+		case "-C":
+			err = p.parseCompareOption(t)
+		case "-k":
+			err = p.parseKeyOption(t)
+		case "-D":
+			err = p.setKind(t, DeleteAllRules)
+		case "-b", "-e", "-f", "-r", "--backlog_wait_time":
+			err = p.parseSetOption(t)
+		default:
+			err = p.errorf(t.col, "unknown option %s", t.text)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return p.finish()
+}
+
+func (p *lineParser) parseRuleOption(t token) error {
+	kind := AddRule
+	if t.text == "-d" {
+		kind = DeleteRule
+	}
+	if err := p.setKind(t, kind); err != nil {
+		return err
+	}
+
+	a, err := p.arg()
+	if err != nil {
+		return err
+	}
+
+	parts := strings.Split(a.text, ",")
+	if len(parts) != 2 {
+		return p.errorf(a.col, "expected <list>,<action> but got %q", a.text)
+	}
+
+	rule := &auditrd.AuditRule{}
+	list, okList := lists[parts[0]]
+	action, okAction := actions[parts[1]]
+	if !okList || !okAction {
+		// auditctl accepts both orders
+		list, okList = lists[parts[1]]
+		action, okAction = actions[parts[0]]
+	}
+	if !okList {
+		return p.errorf(a.col, "unknown filter list in %q", a.text)
+	}
+	if !okAction {
+		return p.errorf(a.col, "unknown action in %q", a.text)
+	}
+
+	rule.List = list
+	rule.Action = action
+	if t.text == "-A" {
+		rule.List |= auditrd.AUDIT_FILTER_PREPEND
+	}
+
+	p.cmd.Rule = rule
+	return nil
+}
+
+func (p *lineParser) parseWatchOption(t token) error {
+	kind := AddRule
+	if t.text == "-W" {
+		kind = DeleteRule
+	}
+	if err := p.setKind(t, kind); err != nil {
+		return err
+	}
+
+	a, err := p.arg()
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(a.text, "/") {
+		return p.errorf(a.col, "watch path must be absolute: %s", a.text)
+	}
+
+	p.watch = &a
+	p.cmd.Rule = &auditrd.AuditRule{
+		List:        auditrd.AUDIT_FILTER_EXIT,
+		Action:      auditrd.AUDIT_ALWAYS,
+		AllSyscalls: true,
+	}
+	return nil
+}
+
+func (p *lineParser) parsePermOption(t token) error {
+	if p.watch == nil {
+		return p.errorf(t.col, "option -p is only valid with a watch")
+	}
+
+	a, err := p.arg()
+	if err != nil {
+		return err
+	}
+	if _, ok := parsePerm(a.text); !ok {
+		return p.errorf(a.col, "invalid permission %q, expected some of rwxa", a.text)
+	}
+	p.perm = &a
+	return nil
+}
+
+func (p *lineParser) ruleRequired(t token) error {
+	if p.cmd.Rule == nil || p.watch != nil {
+		return p.errorf(t.col, "option %s is only valid with -a, -A or -d", t.text)
+	}
+	return nil
+}
+
+func (p *lineParser) parseSyscallOption(t token) error {
+	if err := p.ruleRequired(t); err != nil {
+		return err
+	}
+
+	a, err := p.arg()
+	if err != nil {
+		return err
+	}
+
+	p.sawSyscall = true
+	col := a.col
+	for _, name := range strings.Split(a.text, ",") {
+		switch {
+		case name == "":
+			return p.errorf(col, "empty syscall name")
+		case name == "all":
+			p.cmd.Rule.AllSyscalls = true
+		default:
+			p.syscallNames = append(p.syscallNames, token{text: name, col: col})
+		}
+		col += len(name) + 1
+	}
+
+	return nil
+}
+
+// resolveSyscalls resolves the syscalls given to -S by number or by name in
+// the table of the rule arch, a name is never resolved against another arch.
+func (p *lineParser) resolveSyscalls(arch uint32) ([]int, error) {
+	var syscalls []int
+	for _, t := range p.syscallNames {
+		if n, err := strconv.Atoi(t.text); err == nil {
+			syscalls = append(syscalls, n)
+			continue
+		}
+
+		n, ok, err := lookupSyscall(arch, t.text)
+		if err != nil {
+			return nil, p.errorf(t.col, "cannot resolve syscall %s: %s", t.text, err)
+		}
+		if !ok {
+			return nil, p.errorf(t.col, "unknown syscall %s", t.text)
+		}
+		syscalls = append(syscalls, n)
+	}
+
+	return syscalls, nil
+}
+
+// splitOperator splits a field expression such as uid>=1000 in its name,
+// operator and value. The offset of the value in the expression is returned.
+func splitOperator(expr string) (name string, op uint32, value string, offset int, ok bool) {
+	i := strings.IndexAny(expr, "!=<>&")
+	if i <= 0 {
+		return
+	}
+
+	for _, o := range operators {
+		if strings.HasPrefix(expr[i:], o.token) {
+			offset = i + len(o.token)
+			return expr[:i], o.op, expr[offset:], offset, true
+		}
+	}
+	return
+}
+
+func (p *lineParser) parseFieldOption(t token) error {
+	if err := p.ruleRequired(t); err != nil {
+		return err
+	}
+
+	a, err := p.arg()
+	if err != nil {
+		return err
+	}
+
+	name, op, value, offset, ok := splitOperator(a.text)
+	if !ok {
+		return p.errorf(a.col, "expected <field><op><value> but got %q", a.text)
+	}
+	valueCol := a.col + offset
+
+	def, ok := fields[name]
+	if !ok {
+		return p.errorf(a.col, "unknown field %s", name)
+	}
+	if value == "" {
+		return p.errorf(valueCol, "missing value for field %s", name)
+	}
+
+	f := auditrd.AuditRuleField{Field: def.field, Op: op}
+	switch def.kind {
+	case stringValue:
+		if op != auditrd.AUDIT_EQUAL && op != auditrd.AUDIT_NOT_EQUAL {
+			return p.errorf(a.col, "field %s only supports = and !=", name)
+		}
+		if def.field == auditrd.AUDIT_FILTERKEY {
+			p.cmd.Rule.Keys = append(p.cmd.Rule.Keys, value)
+			return nil
+		}
+		f.Str = value
+	case archValue:
+		if op != auditrd.AUDIT_EQUAL && op != auditrd.AUDIT_NOT_EQUAL {
+			return p.errorf(a.col, "field %s only supports = and !=", name)
+		}
+		if f.Value, ok = parseArch(value); !ok {
+			return p.errorf(valueCol, "unknown arch %s", value)
+		}
+		if op == auditrd.AUDIT_EQUAL && p.cmd.Rule.Arch == 0 {
+			p.cmd.Rule.Arch = f.Value
+			return nil
+		}
+	case uidValue, gidValue:
+		if f.Value, ok = parseID(value, def.kind == gidValue); !ok {
+			return p.errorf(valueCol, "unknown id %s for field %s", value, name)
+		}
+	case exitValue:
+		if f.Value, ok = parseExit(value); !ok {
+			return p.errorf(valueCol, "invalid exit value %s", value)
+		}
+	case permValue:
+		if f.Value, ok = parsePerm(value); !ok {
+			return p.errorf(valueCol, "invalid permission %q, expected some of rwxa", value)
+		}
+	case fileTypeValue:
+		if f.Value, ok = fileTypes[value]; !ok {
+			return p.errorf(valueCol, "unknown file type %s", value)
+		}
+	case successValue:
+		switch value {
+		case "yes", "1":
+			f.Value = 1
+		case "no", "0":
+			f.Value = 0
+		default:
+			return p.errorf(valueCol, "invalid success value %s", value)
+		}
+	default:
+		n, err := strconv.ParseInt(value, 0, 64)
+		if err != nil || n < -1<<31 || n > 1<<32-1 {
+			return p.errorf(valueCol, "invalid number %s for field %s", value, name)
+		}
+		f.Value = uint32(n)
+	}
+
+	p.cmd.Rule.Fields = append(p.cmd.Rule.Fields, f)
+	return nil
+}
+
+func (p *lineParser) parseCompareOption(t token) error {
+	if err := p.ruleRequired(t); err != nil {
+		return err
+	}
+
+	a, err := p.arg()
+	if err != nil {
+		return err
+	}
+
+	left, op, right, offset, ok := splitOperator(a.text)
+	if !ok || (op != auditrd.AUDIT_EQUAL && op != auditrd.AUDIT_NOT_EQUAL) {
+		return p.errorf(a.col, "expected <field>=<field> or <field>!=<field> but got %q", a.text)
+	}
+
+	cmp, ok := comparisons[[2]string{left, right}]
+	if !ok {
+		cmp, ok = comparisons[[2]string{right, left}]
+	}
+	if !ok {
+		return p.errorf(a.col+offset, "fields %s and %s can't be compared", left, right)
+	}
+
+	p.cmd.Rule.Fields = append(p.cmd.Rule.Fields, auditrd.AuditRuleField{
+		Field: auditrd.AUDIT_FIELD_COMPARE,
+		Op:    op,
+		Value: cmp,
+	})
+	return nil
+}
+
+func (p *lineParser) parseKeyOption(t token) error {
+	if p.cmd.Rule == nil {
+		return p.errorf(t.col, "option -k is only valid with a rule or a watch")
+	}
+
+	a, err := p.arg()
+	if err != nil {
+		return err
+	}
+	p.cmd.Rule.Keys = append(p.cmd.Rule.Keys, a.text)
+	return nil
+}
+
+func (p *lineParser) parseSetOption(t token) error {
+	if err := p.setKind(t, SetOption); err != nil {
+		return err
+	}
+
+	a, err := p.arg()
+	if err != nil {
+		return err
+	}
+
+	n, err := strconv.ParseUint(a.text, 10, 32)
+	if err != nil {
+		return p.errorf(a.col, "invalid value %s for %s", a.text, t.text)
+	}
+
+	p.cmd.Option = strings.TrimLeft(t.text, "-")
+	p.cmd.Value = uint32(n)
+	return nil
+}
+
+// finish validates the complete line and fills in the parts of the rule that
+// depend on several options.
+func (p *lineParser) finish() (*Command, error) {
+	rule := p.cmd.Rule
+	if rule == nil {
+		if p.cmd.Kind == AddRule && p.cmd.Option == "" {
+			return nil, p.errorf(p.toks[0].col, "expected one of -a, -A, -d, -w, -W, -D")
+		}
+		return p.cmd, nil
+	}
+
+	if p.watch != nil {
+		field := auditrd.AUDIT_WATCH
+		if fi, err := os.Stat(p.watch.text); err == nil && fi.IsDir() {
+			field = auditrd.AUDIT_DIR
+		}
+
+		fields := []auditrd.AuditRuleField{{
+			Field: field, Op: auditrd.AUDIT_EQUAL, Str: p.watch.text,
+		}}
+		if p.perm != nil {
+			perm, _ := parsePerm(p.perm.text)
+			fields = append(fields, auditrd.AuditRuleField{
+				Field: auditrd.AUDIT_PERM, Op: auditrd.AUDIT_EQUAL, Value: perm,
+			})
+		}
+		rule.Fields = fields
+	} else {
+		list := rule.List &^ auditrd.AUDIT_FILTER_PREPEND
+		if p.sawSyscall && list != auditrd.AUDIT_FILTER_EXIT {
+			return nil, p.errorf(p.toks[0].col, "syscalls are only valid on the exit list")
+		}
+
+		if list == auditrd.AUDIT_FILTER_EXIT && !p.sawSyscall {
+			// No -S on an exit rule means all syscalls
+			rule.AllSyscalls = true
+		}
+
+		if !rule.AllSyscalls {
+			syscalls, err := p.resolveSyscalls(rule.Arch)
+			if err != nil {
+				return nil, err
+			}
+			rule.Syscalls = syscalls
+		}
+	}
+
+	if len(strings.Join(rule.Keys, "\x01")) > auditrd.AUDIT_MAX_KEY_LEN {
+		return nil, p.errorf(p.toks[0].col, "key is longer than %d bytes", auditrd.AUDIT_MAX_KEY_LEN)
+	}
+
+	return p.cmd, nil
+}
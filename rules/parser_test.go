@@ -0,0 +1,162 @@
+package rules
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/open-osquery/auditrd"
+)
+
+func init() {
+	x86_64 := map[string]int{"open": 2, "execve": 59, "openat": 257}
+	tables := map[uint32]map[string]int{
+		0:                         x86_64,
+		auditrd.AUDIT_ARCH_X86_64: x86_64,
+		auditrd.AUDIT_ARCH_I386:   {"open": 5, "execve": 11},
+	}
+	lookupSyscall = func(arch uint32, name string) (int, bool, error) {
+		syscalls, ok := tables[arch]
+		if !ok {
+			return 0, false, errors.New("no syscall table")
+		}
+		n, ok := syscalls[name]
+		return n, ok, nil
+	}
+}
+
+func TestParseRules(t *testing.T) {
+	input := `
+# Delete everything first
+-D
+-b 8192
+
+-a always,exit -F arch=x86_64 -S execve -k exec
+-a exit,always -F arch=x86_64 -S open,openat -F exit=-EACCES -F auid>=1000 -F auid!=unset -k access
+-a always,exit -F arch=x86_64 -S open -C uid!=euid -F exe=/usr/bin/sudo
+-w /etc/passwd -p wa -k identity
+-W /etc/shadow
+`
+
+	cmds, err := Parse(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(cmds) != 7 {
+		t.Fatalf("Expected 7 commands, got %d", len(cmds))
+	}
+
+	if cmds[0].Kind != DeleteAllRules || cmds[0].Line != 3 {
+		t.Errorf("Unexpected first command %+v", cmds[0])
+	}
+
+	if cmds[1].Kind != SetOption || cmds[1].Option != "b" || cmds[1].Value != 8192 {
+		t.Errorf("Unexpected option command %+v", cmds[1])
+	}
+
+	exec := &auditrd.AuditRule{
+		List:     auditrd.AUDIT_FILTER_EXIT,
+		Action:   auditrd.AUDIT_ALWAYS,
+		Arch:     auditrd.AUDIT_ARCH_X86_64,
+		Syscalls: []int{59},
+		Keys:     []string{"exec"},
+	}
+	if !reflect.DeepEqual(cmds[2].Rule, exec) {
+		t.Errorf("Unexpected exec rule %+v", cmds[2].Rule)
+	}
+
+	access := cmds[3].Rule
+	if !reflect.DeepEqual(access.Syscalls, []int{2, 257}) {
+		t.Errorf("Unexpected syscalls %v", access.Syscalls)
+	}
+	expected := []auditrd.AuditRuleField{
+		{Field: auditrd.AUDIT_EXIT, Op: auditrd.AUDIT_EQUAL, Value: uint32(0xfffffff3)},
+		{Field: auditrd.AUDIT_LOGINUID, Op: auditrd.AUDIT_GREATER_THAN_OR_EQUAL, Value: 1000},
+		{Field: auditrd.AUDIT_LOGINUID, Op: auditrd.AUDIT_NOT_EQUAL, Value: 0xffffffff},
+	}
+	if !reflect.DeepEqual(access.Fields, expected) {
+		t.Errorf("Unexpected fields %+v", access.Fields)
+	}
+
+	compare := cmds[4].Rule.Fields
+	if compare[0].Field != auditrd.AUDIT_FIELD_COMPARE ||
+		compare[0].Op != auditrd.AUDIT_NOT_EQUAL || compare[0].Value != 11 {
+		t.Errorf("Unexpected comparison %+v", compare[0])
+	}
+	if compare[1].Field != auditrd.AUDIT_EXE || compare[1].Str != "/usr/bin/sudo" {
+		t.Errorf("Unexpected exe field %+v", compare[1])
+	}
+
+	watch := &auditrd.AuditRule{
+		List:        auditrd.AUDIT_FILTER_EXIT,
+		Action:      auditrd.AUDIT_ALWAYS,
+		AllSyscalls: true,
+		Fields: []auditrd.AuditRuleField{
+			{Field: auditrd.AUDIT_WATCH, Op: auditrd.AUDIT_EQUAL, Str: "/etc/passwd"},
+			{Field: auditrd.AUDIT_PERM, Op: auditrd.AUDIT_EQUAL, Value: 10},
+		},
+		Keys: []string{"identity"},
+	}
+	if !reflect.DeepEqual(cmds[5].Rule, watch) {
+		t.Errorf("Unexpected watch rule %+v", cmds[5].Rule)
+	}
+
+	if cmds[6].Kind != DeleteRule || cmds[6].Rule.Fields[0].Str != "/etc/shadow" {
+		t.Errorf("Unexpected delete watch %+v", cmds[6])
+	}
+}
+
+func TestParseArchSyscalls(t *testing.T) {
+	// The names resolve in the table of the rule arch, wherever -F arch is
+	for _, input := range []string{
+		"-a always,exit -F arch=i386 -S open,execve",
+		"-a always,exit -S open -S execve -F arch=i386",
+	} {
+		cmds, err := Parse(strings.NewReader(input))
+		if err != nil {
+			t.Fatalf("%q: %v", input, err)
+		}
+
+		if !reflect.DeepEqual(cmds[0].Rule.Syscalls, []int{5, 11}) {
+			t.Errorf("%q: expected the i386 syscalls, got %v", input, cmds[0].Rule.Syscalls)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		input  string
+		line   int
+		column int
+	}{
+		{"-a always,exit -S nosuchcall", 1, 19},
+		{"\n-a always,exit -S open,nosuchcall", 2, 24},
+		{"-a always,exit -F uid>=nobodyhere", 1, 24},
+		{"-a always,nowhere", 1, 4},
+		{"-a always,exit -F nosuchfield=1", 1, 19},
+		{"-a always,exit -C uid=obj_gid", 1, 23},
+		{"-w etc/passwd", 1, 4},
+		{"-w /etc/passwd -p z", 1, 19},
+		{"-a always,exit -k", 1, 16},
+		{"-a always,exit -w /etc/passwd", 1, 16},
+		{"-a always,task -S open", 1, 1},
+		{"-l", 1, 1},
+		{"-a always,exit -F arch=aarch64 -S open", 1, 35},
+	}
+
+	for _, tt := range tests {
+		_, err := Parse(strings.NewReader(tt.input))
+		perr, ok := err.(*ParseError)
+		if !ok {
+			t.Errorf("%q: expected a ParseError, got %v", tt.input, err)
+			continue
+		}
+
+		if perr.Line != tt.line || perr.Column != tt.column {
+			t.Errorf("%q: expected error at %d:%d, got %s",
+				tt.input, tt.line, tt.column, perr)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+// Package rules parses audit rules written in the auditctl syntax and loads
+// them in the kernel through the auditrd netlink client.
+package rules
+
+import (
+	"fmt"
+
+	"github.com/golang/glog"
+	"github.com/open-osquery/auditrd"
+)
+
+// CommandKind is the operation requested by a single line of a rules file
+type CommandKind int
+
+const (
+	// AddRule appends (-a, -w) or prepends (-A) a rule
+	AddRule CommandKind = iota
+	// DeleteRule deletes a single rule (-d, -W)
+	DeleteRule
+	// DeleteAllRules deletes every loaded rule (-D)
+	DeleteAllRules
+	// SetOption changes an audit status value (-b, -e, -f, -r,
+	// --backlog_wait_time)
+	SetOption
+)
+
+// Command is a single parsed line of a rules file
+type Command struct {
+	Kind CommandKind
+	Line int
+
+	// Rule is set for AddRule and DeleteRule
+	Rule *auditrd.AuditRule
+
+	// Option and Value are set for SetOption, Option is the auditctl flag
+	// without the leading dashes.
+	Option string
+	Value  uint32
+}
+
+// Apply loads the parsed commands through the client, in order. Commands
+// should come from a successful Parse so that a bad file never half applies.
+func Apply(c auditrd.Client, cmds []Command) error {
+	for _, cmd := range cmds {
+		var err error
+		switch cmd.Kind {
+		case AddRule:
+			err = c.AddRule(cmd.Rule)
+		case DeleteRule:
+			err = c.DeleteRule(cmd.Rule)
+		case DeleteAllRules:
+			err = c.FlushRules()
+		case SetOption:
+			err = setOption(c, cmd)
+		}
+
+		if err != nil {
+			return fmt.Errorf("line %d: %s", cmd.Line, err)
+		}
+	}
+
+	return nil
+}
+
+func setOption(c auditrd.Client, cmd Command) error {
+	switch cmd.Option {
+	case "b":
+		return c.SetBacklogLimit(cmd.Value)
+	case "e":
+		return c.SetEnabled(cmd.Value)
+	case "f":
+		return c.SetFailure(cmd.Value)
+	case "r":
+		return c.SetRateLimit(cmd.Value)
+	case "backlog_wait_time":
+		return c.SetBacklogWaitTime(cmd.Value)
+	}
+
+	glog.Warningf("Ignoring unsupported option -%s on line %d", cmd.Option, cmd.Line)
+	return nil
+}
@@ -0,0 +1,43 @@
+package auditrd
+
+import (
+	"strconv"
+)
+
+// The seccomp filter return actions, the upper 16 bits of the code of a
+// seccomp record. The lower 16 bits are the data of the action, the errno of
+// SECCOMP_RET_ERRNO for example.
+const (
+	SECCOMP_RET_KILL_PROCESS uint64 = 0x80000000
+	SECCOMP_RET_KILL_THREAD  uint64 = 0x00000000
+	SECCOMP_RET_TRAP         uint64 = 0x00030000
+	SECCOMP_RET_ERRNO        uint64 = 0x00050000
+	SECCOMP_RET_USER_NOTIF   uint64 = 0x7fc00000
+	SECCOMP_RET_TRACE        uint64 = 0x7ff00000
+	SECCOMP_RET_LOG          uint64 = 0x7ffc0000
+	SECCOMP_RET_ALLOW        uint64 = 0x7fff0000
+
+	SECCOMP_RET_ACTION_FULL uint64 = 0xffff0000
+	SECCOMP_RET_DATA        uint64 = 0x0000ffff
+)
+
+var seccompActions = map[uint64]string{
+	SECCOMP_RET_KILL_PROCESS: "KILL_PROCESS",
+	SECCOMP_RET_KILL_THREAD:  "KILL",
+	SECCOMP_RET_TRAP:         "TRAP",
+	SECCOMP_RET_ERRNO:        "ERRNO",
+	SECCOMP_RET_USER_NOTIF:   "USER_NOTIF",
+	SECCOMP_RET_TRACE:        "TRACE",
+	SECCOMP_RET_LOG:          "LOG",
+	SECCOMP_RET_ALLOW:        "ALLOW",
+}
+
+// SeccompAction returns the name of the action of a seccomp record code, as
+// auditd names them. KILL is SECCOMP_RET_KILL_THREAD, once the only kill.
+func SeccompAction(code uint64) string {
+	if action, ok := seccompActions[code&SECCOMP_RET_ACTION_FULL]; ok {
+		return action
+	}
+
+	return "0x" + strconv.FormatUint(code&SECCOMP_RET_ACTION_FULL, 16)
+}
@@ -0,0 +1,89 @@
+package auditrd
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strconv"
+)
+
+// Socket address families found in the AUDIT_SOCKADDR records
+const (
+	AF_UNIX    = 1
+	AF_INET    = 2
+	AF_INET6   = 10
+	AF_NETLINK = 16
+)
+
+// Sockaddr is a socket address decoded from the saddr field of an
+// AUDIT_SOCKADDR record. Address and Port are set for the inet families, Path
+// for a unix socket, abstract ones starting with @, and Pid for netlink.
+type Sockaddr struct {
+	Family  string `json:"family"`
+	Address string `json:"address,omitempty"`
+	Port    int    `json:"port,omitempty"`
+	Path    string `json:"path,omitempty"`
+	Pid     int    `json:"pid,omitempty"`
+}
+
+var sockaddrFamilies = map[uint16]string{
+	AF_UNIX:    "unix",
+	AF_INET:    "inet",
+	AF_INET6:   "inet6",
+	AF_NETLINK: "netlink",
+}
+
+// ParseSockaddr decodes a struct sockaddr as logged by the kernel. The family
+// is in host order, the ports and addresses in network order. An unknown
+// family is returned by number without address.
+func ParseSockaddr(b []byte) (*Sockaddr, error) {
+	if len(b) < 2 {
+		return nil, fmt.Errorf("Sockaddr too short, %d bytes", len(b))
+	}
+
+	family := endianness.Uint16(b)
+	sa := &Sockaddr{Family: sockaddrFamilies[family]}
+
+	switch family {
+	case AF_UNIX:
+		path := b[2:]
+		// An abstract socket name starts with a nul byte
+		if len(path) > 0 && path[0] == 0 {
+			sa.Path = "@" + string(path[1:])
+			break
+		}
+
+		for i, c := range path {
+			if c == 0 {
+				path = path[:i]
+				break
+			}
+		}
+		sa.Path = string(path)
+
+	case AF_INET:
+		if len(b) < 8 {
+			return nil, fmt.Errorf("Inet sockaddr too short, %d bytes", len(b))
+		}
+		sa.Port = int(binary.BigEndian.Uint16(b[2:]))
+		sa.Address = net.IP(b[4:8]).String()
+
+	case AF_INET6:
+		if len(b) < 24 {
+			return nil, fmt.Errorf("Inet6 sockaddr too short, %d bytes", len(b))
+		}
+		sa.Port = int(binary.BigEndian.Uint16(b[2:]))
+		sa.Address = net.IP(b[8:24]).String()
+
+	case AF_NETLINK:
+		if len(b) < 8 {
+			return nil, fmt.Errorf("Netlink sockaddr too short, %d bytes", len(b))
+		}
+		sa.Pid = int(endianness.Uint32(b[4:]))
+
+	default:
+		sa.Family = strconv.Itoa(int(family))
+	}
+
+	return sa, nil
+}
@@ -0,0 +1,37 @@
+package auditrd
+
+import (
+	"encoding/hex"
+	"reflect"
+	"testing"
+)
+
+func TestParseSockaddr(t *testing.T) {
+	tests := []struct {
+		saddr string
+		want  *Sockaddr
+	}{
+		{"02000050C0A800010000000000000000", &Sockaddr{Family: "inet", Address: "192.168.0.1", Port: 80}},
+		{"0A0001BB000000002001048600000000000000000000000100000000",
+			&Sockaddr{Family: "inet6", Address: "2001:486::1", Port: 443}},
+		{"01002F72756E2F646F636B65722E736F636B00", &Sockaddr{Family: "unix", Path: "/run/docker.sock"}},
+		{"0100006162737472616374", &Sockaddr{Family: "unix", Path: "@abstract"}},
+		{"100000007B00000000000000", &Sockaddr{Family: "netlink", Pid: 123}},
+		{"11000300", &Sockaddr{Family: "17"}},
+	}
+
+	for _, test := range tests {
+		b, _ := hex.DecodeString(test.saddr)
+		sa, err := ParseSockaddr(b)
+		if err != nil || !reflect.DeepEqual(sa, test.want) {
+			t.Errorf("%s: expected %+v, got %+v, %v", test.saddr, test.want, sa, err)
+		}
+	}
+
+	for _, saddr := range []string{"02", "0200005000", "0A0001BB00000000"} {
+		b, _ := hex.DecodeString(saddr)
+		if _, err := ParseSockaddr(b); err == nil {
+			t.Errorf("%s: expected an error", saddr)
+		}
+	}
+}
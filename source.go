@@ -0,0 +1,83 @@
+package auditrd
+
+import (
+	"io"
+	"sync"
+)
+
+// Source yields the raw audit records to group, whether they come from the
+// kernel, a log file or anything else.
+type Source interface {
+	// Next returns the next record, with its type, header time, sequence and
+	// the data following the header. io.EOF is returned once the source is
+	// exhausted or closed, other errors are reported and reading goes on.
+	Next() (*AuditMessage, error)
+
+	// Close stops the source, a blocked Next returns io.EOF
+	Close() error
+}
+
+// statusSource is a Source able to query the kernel audit status
+type statusSource interface {
+	GetStatus() (*AuditStatus, error)
+}
+
+// growableSource is a Source reading from a socket which can be grown when the
+// kernel overruns it.
+type growableSource interface {
+	GrowReceiveBuffer(ceiling int) (int, error)
+}
+
+// netlinkSource reads the audit records from a netlink client
+type netlinkSource struct {
+	Client
+}
+
+// NewNetlinkSource returns a Source reading the audit events received by the
+// client, the source owns the client and closes it.
+func NewNetlinkSource(c Client) Source {
+	return &netlinkSource{Client: c}
+}
+
+func (n *netlinkSource) Next() (*AuditMessage, error) {
+	msg, err := n.Receive()
+	if err == ErrClientClosed {
+		return nil, io.EOF
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return newAuditMessage(msg), nil
+}
+
+// channelSource yields the records sent to a channel
+type channelSource struct {
+	records   <-chan *AuditMessage
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+// NewChannelSource returns a Source yielding the records sent to the channel
+// until it's closed. It's meant to feed records built in memory, by tests for
+// example.
+func NewChannelSource(records <-chan *AuditMessage) Source {
+	return &channelSource{records: records, closed: make(chan struct{})}
+}
+
+func (c *channelSource) Next() (*AuditMessage, error) {
+	select {
+	case msg, ok := <-c.records:
+		if !ok {
+			return nil, io.EOF
+		}
+		return msg, nil
+	case <-c.closed:
+		return nil, io.EOF
+	}
+}
+
+func (c *channelSource) Close() error {
+	c.closeOnce.Do(func() { close(c.closed) })
+	return nil
+}
@@ -0,0 +1,51 @@
+package auditrd
+
+import (
+	"context"
+	"io"
+	"testing"
+)
+
+func TestNetlinkSource(t *testing.T) {
+	c := newFakeClient()
+	src := NewNetlinkSource(c)
+
+	c.messages <- receiveResult{msg: msg1307()}
+	msg, err := src.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if msg.Type != AUDIT_CWD || msg.Seq != 49129 || msg.Data != `cwd="/etc"` {
+		t.Errorf("Unexpected record %+v", msg)
+	}
+
+	src.Close()
+	if _, err := src.Next(); err != io.EOF {
+		t.Errorf("Expected io.EOF once closed, got %v", err)
+	}
+}
+
+func TestChannelSourceReader(t *testing.T) {
+	records := make(chan *AuditMessage, 3)
+	records <- &AuditMessage{Type: AUDIT_SYSCALL, Seq: 7, AuditTime: "1.000", Data: "syscall=59"}
+	records <- &AuditMessage{Type: AUDIT_CWD, Seq: 7, AuditTime: "1.000", Data: `cwd="/"`}
+	records <- &AuditMessage{Type: AUDIT_SYSCALL, Seq: 8, AuditTime: "1.001", Data: "syscall=2"}
+	close(records)
+
+	rd, err := NewSourceReader(context.Background(), NewChannelSource(records))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var groups []*AuditMessageGroup
+	for g := range rd.Events() {
+		groups = append(groups, g)
+	}
+
+	// Both groups are flushed once the channel is closed
+	if len(groups) != 2 || groups[0].Seq != 7 || len(groups[0].Msgs) != 2 ||
+		groups[1].Seq != 8 {
+		t.Errorf("Unexpected groups %+v", groups)
+	}
+}
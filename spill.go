@@ -0,0 +1,167 @@
+package auditrd
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// spillQueue is a bounded on-disk FIFO of message groups, used when the
+// output channel is full and the BackpressureSpill policy is selected. Each
+// group is stored as its gob encoding prefixed by its length. The file is
+// removed as soon as it's created so nothing is left behind on exit.
+type spillQueue struct {
+	mu       sync.Mutex
+	file     *os.File
+	readOff  int64
+	writeOff int64
+	maxBytes int64
+
+	// pending counts the groups pushed but not delivered yet, including the
+	// one being written to the channel by the drainer.
+	pending int
+
+	// ready is signaled when a group is pushed
+	ready chan struct{}
+}
+
+func newSpillQueue(dir string, maxBytes int64) (*spillQueue, error) {
+	f, err := os.CreateTemp(dir, "auditrd-spill-")
+	if err != nil {
+		return nil, fmt.Errorf("Could not create the spill file: %s", err)
+	}
+
+	// Keep the file open but unlinked
+	os.Remove(f.Name())
+
+	return &spillQueue{
+		file:     f,
+		maxBytes: maxBytes,
+		ready:    make(chan struct{}, 1),
+	}, nil
+}
+
+// empty tells if every pushed group has been delivered, only then can the
+// output channel be written directly without reordering the groups.
+func (q *spillQueue) empty() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.pending == 0
+}
+
+// push appends a group to the queue, it returns false if the queue is full
+func (q *spillQueue) push(g *AuditMessageGroup) (bool, error) {
+	buf := new(bytes.Buffer)
+	buf.Write(make([]byte, 4))
+	if err := gob.NewEncoder(buf).Encode(g); err != nil {
+		return false, err
+	}
+	data := buf.Bytes()
+	endianness.PutUint32(data, uint32(len(data)-4))
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.writeOff+int64(len(data)) > q.maxBytes {
+		if err := q.compact(); err != nil {
+			return false, err
+		}
+		if q.writeOff+int64(len(data)) > q.maxBytes {
+			return false, nil
+		}
+	}
+
+	if _, err := q.file.WriteAt(data, q.writeOff); err != nil {
+		return false, err
+	}
+	q.writeOff += int64(len(data))
+	q.pending++
+
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+
+	return true, nil
+}
+
+// pop reads the oldest group of the queue, nil if there is none. The group
+// stays pending until delivered is called. A group that can't be decoded is
+// skipped and, when the queue itself can't be read, every unread group is
+// discarded. The number of groups skipped or discarded is returned with the
+// error, they are no longer pending.
+func (q *spillQueue) pop() (*AuditMessageGroup, int, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.readOff == q.writeOff {
+		return nil, 0, nil
+	}
+
+	var header [4]byte
+	if _, err := q.file.ReadAt(header[:], q.readOff); err != nil {
+		return nil, q.reset(), err
+	}
+	size := int64(endianness.Uint32(header[:]))
+	if q.readOff+4+size > q.writeOff {
+		return nil, q.reset(), fmt.Errorf("Spilled group of %d bytes past the end of the queue", size)
+	}
+
+	var g AuditMessageGroup
+	r := io.NewSectionReader(q.file, q.readOff+4, size)
+	err := gob.NewDecoder(r).Decode(&g)
+
+	q.readOff += 4 + size
+	if q.readOff == q.writeOff {
+		// Everything was read, start over at the beginning of the file
+		q.readOff, q.writeOff = 0, 0
+		q.file.Truncate(0)
+	}
+
+	if err != nil {
+		q.pending--
+		return nil, 1, err
+	}
+	return &g, 0, nil
+}
+
+// reset discards the unread groups and returns how many there were. It's
+// only called by pop, every group popped before was delivered already.
+func (q *spillQueue) reset() int {
+	discarded := q.pending
+	q.readOff, q.writeOff, q.pending = 0, 0, 0
+	q.file.Truncate(0)
+	return discarded
+}
+
+// delivered marks a popped group as written to the output
+func (q *spillQueue) delivered() {
+	q.mu.Lock()
+	q.pending--
+	q.mu.Unlock()
+}
+
+// compact moves the unread groups to the beginning of the file
+func (q *spillQueue) compact() error {
+	if q.readOff == 0 {
+		return nil
+	}
+
+	unread := make([]byte, q.writeOff-q.readOff)
+	if _, err := q.file.ReadAt(unread, q.readOff); err != nil {
+		return err
+	}
+	if _, err := q.file.WriteAt(unread, 0); err != nil {
+		return err
+	}
+
+	q.readOff, q.writeOff = 0, int64(len(unread))
+	return q.file.Truncate(q.writeOff)
+}
+
+func (q *spillQueue) close() error {
+	return q.file.Close()
+}
@@ -0,0 +1,81 @@
+package auditrd
+
+import (
+	"testing"
+)
+
+func TestSpillQueue(t *testing.T) {
+	q, err := newSpillQueue(t.TempDir(), 512)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.close()
+
+	// Fill the queue up
+	pushed := uint64(0)
+	for {
+		ok, err := q.push(&AuditMessageGroup{Seq: pushed})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ok {
+			break
+		}
+		pushed++
+	}
+
+	if pushed == 0 {
+		t.Fatal("Nothing could be pushed")
+	}
+
+	// Reading one group makes room for another one once compacted
+	g, _, err := q.pop()
+	if err != nil || g == nil || g.Seq != 0 {
+		t.Fatalf("Expected group 0, got %+v, %v", g, err)
+	}
+	q.delivered()
+
+	if ok, err := q.push(&AuditMessageGroup{Seq: pushed}); !ok || err != nil {
+		t.Fatalf("Push after a pop failed: %v", err)
+	}
+
+	for seq := uint64(1); seq <= pushed; seq++ {
+		g, _, err := q.pop()
+		if err != nil || g == nil || g.Seq != seq {
+			t.Fatalf("Expected group %d, got %+v, %v", seq, g, err)
+		}
+		q.delivered()
+	}
+
+	if !q.empty() || q.writeOff != 0 {
+		t.Error("Queue should be empty and truncated")
+	}
+}
+
+func TestSpillQueueReadError(t *testing.T) {
+	q, err := newSpillQueue(t.TempDir(), 1<<16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.close()
+
+	for seq := uint64(0); seq < 2; seq++ {
+		if ok, err := q.push(&AuditMessageGroup{Seq: seq}); !ok || err != nil {
+			t.Fatalf("Push failed: %v", err)
+		}
+	}
+
+	// The groups can't be read back anymore, they are all discarded at once
+	q.file.Truncate(0)
+	g, discarded, err := q.pop()
+	if err == nil || g != nil || discarded != 2 {
+		t.Fatalf("Expected 2 groups discarded, got %+v, %d, %v", g, discarded, err)
+	}
+
+	if !q.empty() {
+		t.Error("Queue should be empty after a read error")
+	}
+	if g, _, err := q.pop(); g != nil || err != nil {
+		t.Errorf("Expected nothing to pop, got %+v, %v", g, err)
+	}
+}
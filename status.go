@@ -0,0 +1,177 @@
+// +build linux
+
+package auditrd
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// Mask bits of struct audit_status telling the kernel which values to change,
+// see https://github.com/torvalds/linux/blob/v5.6/include/uapi/linux/audit.h#L326
+const (
+	AUDIT_STATUS_ENABLED           uint32 = 0x0001
+	AUDIT_STATUS_FAILURE           uint32 = 0x0002
+	AUDIT_STATUS_PID               uint32 = 0x0004
+	AUDIT_STATUS_RATE_LIMIT        uint32 = 0x0008
+	AUDIT_STATUS_BACKLOG_LIMIT     uint32 = 0x0010
+	AUDIT_STATUS_BACKLOG_WAIT_TIME uint32 = 0x0020
+	AUDIT_STATUS_LOST              uint32 = 0x0040
+)
+
+// Bits of AuditStatus.FeatureBitmap
+const (
+	AUDIT_FEATURE_BITMAP_BACKLOG_LIMIT     uint32 = 0x00000001
+	AUDIT_FEATURE_BITMAP_BACKLOG_WAIT_TIME uint32 = 0x00000002
+	AUDIT_FEATURE_BITMAP_EXECUTABLE_PATH   uint32 = 0x00000004
+	AUDIT_FEATURE_BITMAP_EXCLUDE_EXTEND    uint32 = 0x00000008
+	AUDIT_FEATURE_BITMAP_SESSIONID_FILTER  uint32 = 0x00000010
+	AUDIT_FEATURE_BITMAP_LOST_RESET        uint32 = 0x00000020
+	AUDIT_FEATURE_BITMAP_FILTER_FS         uint32 = 0x00000040
+)
+
+// Values for SetFailure
+const (
+	AUDIT_FAIL_SILENT uint32 = 0
+	AUDIT_FAIL_PRINTK uint32 = 1
+	AUDIT_FAIL_PANIC  uint32 = 2
+)
+
+// AuditStatus is the state of the kernel audit subsystem as reported in reply
+// to AUDIT_GET.
+type AuditStatus struct {
+	// Enabled is 0 when auditing is off, 1 when it's on and 2 when the
+	// configuration is locked until the next reboot.
+	Enabled uint32 `json:"enabled"`
+
+	// Failure is one of the AUDIT_FAIL_* values
+	Failure uint32 `json:"failure"`
+
+	// Pid is the process the kernel sends the audit events to
+	Pid uint32 `json:"pid"`
+
+	RateLimit    uint32 `json:"rate_limit"`
+	BacklogLimit uint32 `json:"backlog_limit"`
+
+	// Lost counts the events the kernel dropped since boot or the last reset
+	Lost    uint32 `json:"lost"`
+	Backlog uint32 `json:"backlog"`
+
+	// FeatureBitmap holds the AUDIT_FEATURE_BITMAP_* bits of the features the
+	// kernel supports.
+	FeatureBitmap   uint32 `json:"feature_bitmap"`
+	BacklogWaitTime uint32 `json:"backlog_wait_time"`
+}
+
+// GetStatus queries the kernel for the current audit status
+func (n *netlinkClient) GetStatus() (*AuditStatus, error) {
+	replies, err := n.Request(&NetlinkRequest{
+		Type:      AUDIT_GET,
+		ReplyType: AUDIT_GET,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(replies) == 0 {
+		return nil, fmt.Errorf("No reply to the status request")
+	}
+
+	return unmarshalAuditStatus(replies[0].Data)
+}
+
+// unmarshalAuditStatus decodes the struct audit_status sent in reply to
+// AUDIT_GET. Older kernels send a shorter struct and newer ones append fields,
+// only what both sides know about is decoded.
+func unmarshalAuditStatus(reply []byte) (*AuditStatus, error) {
+	data := make([]byte, binary.Size(auditStatusPayload{}))
+	copy(data, reply)
+
+	var p auditStatusPayload
+	if err := binary.Read(bytes.NewReader(data), endianness, &p); err != nil {
+		return nil, err
+	}
+
+	return &AuditStatus{
+		Enabled:         p.Enabled,
+		Failure:         p.Failure,
+		Pid:             p.Pid,
+		RateLimit:       p.RateLimit,
+		BacklogLimit:    p.BacklogLimit,
+		Lost:            p.Lost,
+		Backlog:         p.Backlog,
+		FeatureBitmap:   p.Version,
+		BacklogWaitTime: p.BacklogWaitTime,
+	}, nil
+}
+
+// setStatus sends an AUDIT_SET for the values selected in the mask and waits
+// for the kernel to acknowledge it.
+func (n *netlinkClient) setStatus(p *auditStatusPayload) error {
+	buf := new(bytes.Buffer)
+	binary.Write(buf, endianness, p)
+
+	_, err := n.Request(&NetlinkRequest{Type: AUDIT_SET, Payload: buf.Bytes()})
+	return err
+}
+
+// SetEnabled turns auditing off (0), on (1) or locks the configuration (2)
+func (n *netlinkClient) SetEnabled(enabled uint32) error {
+	return n.setStatus(&auditStatusPayload{
+		Mask:    AUDIT_STATUS_ENABLED,
+		Enabled: enabled,
+	})
+}
+
+// SetFailure sets what the kernel does on a critical audit error, one of the
+// AUDIT_FAIL_* values.
+func (n *netlinkClient) SetFailure(failure uint32) error {
+	return n.setStatus(&auditStatusPayload{
+		Mask:    AUDIT_STATUS_FAILURE,
+		Failure: failure,
+	})
+}
+
+// SetPid registers the process the kernel sends the audit events to, they are
+// delivered to the socket of this client. A pid of 0 releases the registration.
+func (n *netlinkClient) SetPid(pid uint32) error {
+	return n.setStatus(&auditStatusPayload{
+		Mask: AUDIT_STATUS_PID,
+		Pid:  pid,
+	})
+}
+
+// SetRateLimit sets the maximum number of messages per second, 0 is unlimited
+func (n *netlinkClient) SetRateLimit(limit uint32) error {
+	return n.setStatus(&auditStatusPayload{
+		Mask:      AUDIT_STATUS_RATE_LIMIT,
+		RateLimit: limit,
+	})
+}
+
+// SetBacklogLimit sets the maximum number of buffers the kernel queues while
+// waiting for the audit daemon.
+func (n *netlinkClient) SetBacklogLimit(limit uint32) error {
+	return n.setStatus(&auditStatusPayload{
+		Mask:         AUDIT_STATUS_BACKLOG_LIMIT,
+		BacklogLimit: limit,
+	})
+}
+
+// SetBacklogWaitTime sets the time, in jiffies, the kernel waits when the
+// backlog limit is reached.
+func (n *netlinkClient) SetBacklogWaitTime(wait uint32) error {
+	return n.setStatus(&auditStatusPayload{
+		Mask:            AUDIT_STATUS_BACKLOG_WAIT_TIME,
+		BacklogWaitTime: wait,
+	})
+}
+
+// ResetLost resets the kernel lost counter, it needs a kernel with
+// AUDIT_FEATURE_BITMAP_LOST_RESET.
+func (n *netlinkClient) ResetLost() error {
+	return n.setStatus(&auditStatusPayload{
+		Mask: AUDIT_STATUS_LOST,
+	})
+}
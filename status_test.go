@@ -0,0 +1,54 @@
+package auditrd
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func TestUnmarshalAuditStatus(t *testing.T) {
+	buf := new(bytes.Buffer)
+	binary.Write(buf, endianness, &auditStatusPayload{
+		Mask:            0x7f,
+		Enabled:         1,
+		Failure:         AUDIT_FAIL_PRINTK,
+		Pid:             1234,
+		RateLimit:       100,
+		BacklogLimit:    8192,
+		Lost:            42,
+		Backlog:         3,
+		Version:         AUDIT_FEATURE_BITMAP_LOST_RESET,
+		BacklogWaitTime: 60000,
+	})
+	// Newer kernels append backlog_wait_time_actual
+	binary.Write(buf, endianness, uint32(7))
+
+	s, err := unmarshalAuditStatus(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := AuditStatus{
+		Enabled:         1,
+		Failure:         AUDIT_FAIL_PRINTK,
+		Pid:             1234,
+		RateLimit:       100,
+		BacklogLimit:    8192,
+		Lost:            42,
+		Backlog:         3,
+		FeatureBitmap:   AUDIT_FEATURE_BITMAP_LOST_RESET,
+		BacklogWaitTime: 60000,
+	}
+	if *s != expected {
+		t.Errorf("Unexpected status %+v", s)
+	}
+
+	// Kernels before 3.14 don't send backlog_wait_time
+	s, err = unmarshalAuditStatus(buf.Bytes()[:36])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Lost != 42 || s.BacklogWaitTime != 0 {
+		t.Errorf("Unexpected status from a short reply %+v", s)
+	}
+}
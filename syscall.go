@@ -2,8 +2,10 @@ package auditrd
 
 import (
 	"bytes"
+	"fmt"
 	"os"
 	"os/exec"
+	"runtime"
 	"strconv"
 	"strings"
 	"sync"
@@ -17,8 +19,28 @@ var (
 	syscallNumberToName = map[int]string{}
 	fimSyscalls         = map[int]bool{}
 	mu                  sync.Mutex
+
+	// archSyscalls are the syscall tables of the archs other than the host's,
+	// by AUDIT_ARCH_* value, generated on first use.
+	archSyscalls = map[uint32]map[string]int{}
 )
 
+// ausyscallArchs are the names ausyscall knows the AUDIT_ARCH_* values by
+var ausyscallArchs = map[uint32]string{
+	AUDIT_ARCH_X86_64:  "x86_64",
+	AUDIT_ARCH_I386:    "i386",
+	AUDIT_ARCH_AARCH64: "aarch64",
+	AUDIT_ARCH_ARM:     "arm",
+}
+
+// hostArchs are the AUDIT_ARCH_* values of the Go architectures
+var hostArchs = map[string]uint32{
+	"amd64": AUDIT_ARCH_X86_64,
+	"386":   AUDIT_ARCH_I386,
+	"arm64": AUDIT_ARCH_AARCH64,
+	"arm":   AUDIT_ARCH_ARM,
+}
+
 // Generate the syscall Map on a machine at runtime using the ausyscall since
 // there is no reliable way to get it at buildtime for multiple versions of
 // kernels or architecture. Other way could be to list down individual syscalls
@@ -33,18 +55,37 @@ func generateSyscallMap() error {
 		glog.Warningf("Syscall map already initialized")
 		return nil
 	}
+	names, err := dumpSyscalls()
+	if err != nil {
+		return err
+	}
+
+	for syscallName, syscallNumber := range names {
+		syscallNameToNumber[syscallName] = syscallNumber
+		syscallNumberToName[syscallNumber] = syscallName
+	}
+
+	generateFIMSyscalls()
+
+	return nil
+}
+
+// dumpSyscalls returns the syscall table printed by ausyscall --dump, of the
+// host or of the arch passed.
+func dumpSyscalls(arch ...string) (map[string]int, error) {
 	_, err := os.Stat("/usr/bin/ausyscall")
 	if err != nil {
-		return errors.Wrap(err, "Failed to find ausyscall")
+		return nil, errors.Wrap(err, "Failed to find ausyscall")
 	}
 
-	cmd := exec.Command("/usr/bin/ausyscall", "--dump")
+	cmd := exec.Command("/usr/bin/ausyscall", append(arch, "--dump")...)
 	var out bytes.Buffer
 	cmd.Stdout = &out
 	if err := cmd.Run(); err != nil {
-		return err
+		return nil, err
 	}
 
+	names := make(map[string]int)
 	rd := &out
 	for {
 		line, err := rd.ReadBytes('\n')
@@ -53,16 +94,17 @@ func generateSyscallMap() error {
 		}
 
 		tokens := bytes.Split(bytes.Trim(line, " \n"), []byte{'\t'})
-		syscallNumber, _ := strconv.Atoi(string(tokens[0]))
+		syscallNumber, err := strconv.Atoi(string(tokens[0]))
+		if err != nil {
+			// The header line of the dump
+			continue
+		}
 		syscallName := strings.ToLower(string(tokens[len(tokens)-1]))
 
-		syscallNameToNumber[syscallName] = syscallNumber
-		syscallNumberToName[syscallNumber] = syscallName
+		names[syscallName] = syscallNumber
 	}
 
-	generateFIMSyscalls()
-
-	return nil
+	return names, nil
 }
 
 func SyscallName(syscallNumber int) string {
@@ -73,6 +115,51 @@ func SyscallNumber(syscallName string) int {
 	return syscallNameToNumber[strings.ToLower(syscallName)]
 }
 
+// LookupSyscall returns the number of a syscall by name and whether the name
+// is known at all. The syscall map is generated on first use.
+func LookupSyscall(syscallName string) (int, bool) {
+	if len(syscallNameToNumber) == 0 {
+		if err := generateSyscallMap(); err != nil {
+			glog.Error("Failed to generate the syscall map: ", err)
+		}
+	}
+
+	n, ok := syscallNameToNumber[strings.ToLower(syscallName)]
+	return n, ok
+}
+
+// LookupArchSyscall returns the number of a syscall by name in the table of an
+// arch, one of the AUDIT_ARCH_* values, and whether the name is known. 0 or the
+// host arch use the host table, the tables of the other archs are generated
+// with ausyscall on first use. An error is returned when there is no table for
+// the arch, rather than resolving the name against another arch.
+func LookupArchSyscall(arch uint32, syscallName string) (int, bool, error) {
+	if arch == 0 || arch == hostArchs[runtime.GOARCH] {
+		n, ok := LookupSyscall(syscallName)
+		return n, ok, nil
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	names, ok := archSyscalls[arch]
+	if !ok {
+		name, known := ausyscallArchs[arch]
+		if !known {
+			return 0, false, fmt.Errorf("No syscall table for arch 0x%x", arch)
+		}
+
+		var err error
+		if names, err = dumpSyscalls(name); err != nil {
+			return 0, false, errors.Wrapf(err, "Failed to get the %s syscall table", name)
+		}
+		archSyscalls[arch] = names
+	}
+
+	n, ok := names[strings.ToLower(syscallName)]
+	return n, ok, nil
+}
+
 func IsExecSyscall(syscallNumber int) bool {
 	s, ok := syscallNumberToName[syscallNumber]
 	if !ok {
@@ -127,7 +214,57 @@ func generateFIMSyscalls() {
 	}
 }
 
+// IsSocketSyscall tells whether a syscall connects, binds or sends to a socket
+// address, the address is in the AUDIT_SOCKADDR record.
+func IsSocketSyscall(syscallNumber int) bool {
+	switch syscallNumberToName[syscallNumber] {
+	case "connect", "bind", "accept", "accept4", "sendto", "sendmsg":
+		return true
+	}
+
+	return false
+}
+
+// IsKernelSyscall tells whether a syscall loads or unloads a kernel module.
+// The bpf syscall is one only for the BPF_PROG_LOAD command, the audit context
+// tells.
+func IsKernelSyscall(syscallNumber int) bool {
+	switch syscallNumberToName[syscallNumber] {
+	case "init_module", "finit_module", "delete_module":
+		return true
+	}
+
+	return false
+}
+
+// IsTargetSyscall tells whether a syscall acts on another process, tracing it,
+// writing to its memory or signalling it.
+func IsTargetSyscall(syscallNumber int) bool {
+	_, ok := targetArgs[syscallNumberToName[syscallNumber]]
+	return ok
+}
+
+// IsPrivilegeSyscall tells whether a syscall changes the ids or the
+// capabilities of a process.
+func IsPrivilegeSyscall(syscallNumber int) bool {
+	s := strings.TrimSuffix(syscallNumberToName[syscallNumber], "32")
+	if _, ok := setIDArgs[s]; ok {
+		return true
+	}
+
+	return s == "capset"
+}
+
+// IsMacEvent tells whether a record type is a SELinux or AppArmor access
+// decision, from the kernel or from user space.
+func IsMacEvent(eventType uint16) bool {
+	return eventType == AUDIT_AVC || eventType == AUDIT_USER_AVC ||
+		(eventType >= AUDIT_FIRST_APPARMOR && eventType <= AUDIT_LAST_APPARMOR)
+}
+
+// IsUserEvent tells whether a record type is a message from user space, like
+// USER_LOGIN or ADD_USER.
 func IsUserEvent(eventType uint16) bool {
-	//return eventType >= AUDIT_FIRST_USER_MSG && eventType <= AUDIT_LAST_USER_MSG
-	return eventType == AUDIT_USER_ACCT
+	return (eventType >= AUDIT_FIRST_USER_MSG && eventType <= AUDIT_LAST_USER_MSG) ||
+		(eventType >= AUDIT_FIRST_USER_MSG2 && eventType <= AUDIT_LAST_USER_MSG2)
 }
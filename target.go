@@ -0,0 +1,50 @@
+package auditrd
+
+// ProcessTarget is a process traced or signalled by the process of a target
+// event, from an OBJ_PID record. Only the Pid is known when the syscall didn't
+// log one.
+type ProcessTarget struct {
+	Pid     int    `json:"pid"`
+	Auid    int    `json:"auid"`
+	Uid     int    `json:"uid"`
+	Session int    `json:"ses"`
+	Comm    string `json:"comm,omitempty"`
+	Context string `json:"context,omitempty"`
+}
+
+// ptraceRequests are the names of the ptrace requests, see
+// include/uapi/linux/ptrace.h
+var ptraceRequests = map[uint64]string{
+	0:      "PTRACE_TRACEME",
+	1:      "PTRACE_PEEKTEXT",
+	2:      "PTRACE_PEEKDATA",
+	3:      "PTRACE_PEEKUSER",
+	4:      "PTRACE_POKETEXT",
+	5:      "PTRACE_POKEDATA",
+	6:      "PTRACE_POKEUSER",
+	7:      "PTRACE_CONT",
+	8:      "PTRACE_KILL",
+	9:      "PTRACE_SINGLESTEP",
+	12:     "PTRACE_GETREGS",
+	13:     "PTRACE_SETREGS",
+	14:     "PTRACE_GETFPREGS",
+	15:     "PTRACE_SETFPREGS",
+	16:     "PTRACE_ATTACH",
+	17:     "PTRACE_DETACH",
+	24:     "PTRACE_SYSCALL",
+	0x4200: "PTRACE_SETOPTIONS",
+	0x4204: "PTRACE_GETREGSET",
+	0x4205: "PTRACE_SETREGSET",
+	0x4206: "PTRACE_SEIZE",
+	0x4207: "PTRACE_INTERRUPT",
+}
+
+// targetArgs are the argument holding the pid of the target of a syscall, and
+// the one holding the signal sent, or -1
+var targetArgs = map[string][2]int{
+	"ptrace":            {1, -1},
+	"process_vm_writev": {0, -1},
+	"kill":              {0, 1},
+	"tkill":             {0, 1},
+	"tgkill":            {1, 2},
+}
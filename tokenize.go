@@ -2,6 +2,7 @@ package auditrd
 
 import (
 	"bytes"
+	"strings"
 )
 
 const sep = byte('=')
@@ -44,3 +45,66 @@ func Tokenize(data string) map[string]string {
 	}
 	return m
 }
+
+// tokenizeUserRecord tokenizes a user space record like Tokenize, with the
+// single quoted values like its msg='...' kept whole. Their fields are
+// tokenized in turn, recursively, and added along.
+//
+// A quote opens a value right after the = and closes it before a space or the
+// end of the data. The double quotes are left alone, the values with a space
+// are hex encoded so an unbalanced one can't swallow the rest of the record.
+func tokenizeUserRecord(data string) map[string]string {
+	m := make(map[string]string)
+	escape := false
+	depth := 0
+	token := bytes.Buffer{}
+
+	for i := 0; i < len(data); i++ {
+		if escape {
+			escape = false
+			token.WriteByte(data[i])
+			continue
+		}
+
+		// The escapes within a quoted value are left to its own tokenizing
+		if data[i] == '\\' {
+			escape = true
+			if depth > 0 {
+				token.WriteByte(data[i])
+			}
+			continue
+		}
+
+		switch {
+		case data[i] == '\'' && i > 0 && data[i-1] == sep:
+			depth++
+		case data[i] == '\'' && depth > 0 && (i+1 == len(data) || data[i+1] == ' '):
+			depth--
+		case data[i] == ' ' && depth == 0:
+			addUserField(m, token.String())
+			token.Reset()
+			continue
+		}
+		token.WriteByte(data[i])
+	}
+
+	addUserField(m, token.String())
+	return m
+}
+
+// addUserField adds a key=value field of tokenizeUserRecord, and the fields of
+// its value if single quoted.
+func addUserField(m map[string]string, field string) {
+	eq := strings.IndexByte(field, sep)
+	if eq == -1 {
+		return
+	}
+
+	key, value := field[:eq], field[eq+1:]
+	if len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'' {
+		for k, v := range tokenizeUserRecord(value[1 : len(value)-1]) {
+			m[k] = v
+		}
+	}
+	m[key] = value
+}
@@ -0,0 +1,72 @@
+package auditrd
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	got := Tokenize(`pid=1 uid=0 msg='op=PAM:session_open acct="root" res=success' key=\"x\"`)
+	want := map[string]string{
+		"pid":  "1",
+		"uid":  "0",
+		"msg":  `'op=PAM:session_open`,
+		"acct": `"root"`,
+		"res":  `success'`,
+		"key":  `"x"`,
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+}
+
+func TestTokenizeUserRecord(t *testing.T) {
+	got := tokenizeUserRecord(`pid=1 uid=0 msg='op=PAM:session_open acct="root" res=success' key=\"x\"`)
+	want := map[string]string{
+		"pid":  "1",
+		"uid":  "0",
+		"msg":  `'op=PAM:session_open acct="root" res=success'`,
+		"op":   "PAM:session_open",
+		"acct": `"root"`,
+		"res":  "success",
+		"key":  `"x"`,
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+
+	// The quoted values are tokenized recursively
+	got = tokenizeUserRecord(`pid=1 msg='op=x info='exe="/tmp/it's" ok=1' res=success' ses=2`)
+	want = map[string]string{
+		"pid":  "1",
+		"msg":  `'op=x info='exe="/tmp/it's" ok=1' res=success'`,
+		"op":   "x",
+		"info": `'exe="/tmp/it's" ok=1'`,
+		"exe":  `"/tmp/it's"`,
+		"ok":   "1",
+		"res":  "success",
+		"ses":  "2",
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+}
+
+func TestTokenizeUserRecordUnbalancedQuote(t *testing.T) {
+	got := tokenizeUserRecord(`pid=1 msg='op=x acct="root res=failed' ses=2`)
+	want := map[string]string{
+		"pid":  "1",
+		"msg":  `'op=x acct="root res=failed'`,
+		"op":   "x",
+		"acct": `"root`,
+		"res":  "failed",
+		"ses":  "2",
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+}